@@ -0,0 +1,75 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Alert is a MozDef alert as stored in the alerts indices
+type Alert struct {
+	ID           string       `json:"-"`
+	Cluster      string       `json:"-"`
+	Category     string       `json:"category"`
+	Severity     string       `json:"severity"`
+	Summary      string       `json:"summary"`
+	UTCTimestamp time.Time    `json:"utctimestamp"`
+	Tags         []string     `json:"tags"`
+	Events       []AlertEvent `json:"events"`
+}
+
+// AlertEvent is a reference to an event that triggered an alert, with the
+// event document as it was when the alert was raised
+type AlertEvent struct {
+	DocumentIndex  string          `json:"documentindex"`
+	DocumentID     string          `json:"documentid"`
+	DocumentSource json.RawMessage `json:"documentsource,omitempty"`
+}
+
+// AlertSourceFields are the document fields used by Alert, the events are
+// limited to their references and the fields needed to show them
+var AlertSourceFields = []string{
+	"category", "severity", "summary", "utctimestamp", "tags",
+	"events.documentindex", "events.documentid",
+	"events.documentsource.hostname", "events.documentsource.summary",
+	"events.documentsource.details.hostname",
+}
+
+// ParseAlert decodes the alert from an event returned by a search of the
+// alerts indices, which must have been returned with its document
+func ParseAlert(e Event) (Alert, error) {
+	var ret Alert
+	if len(e.Raw) == 0 {
+		return ret, errors.New("alert event has no document")
+	}
+	err := json.Unmarshal(e.Raw, &ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.ID = e.ID
+	ret.Cluster = e.Cluster
+	return ret, nil
+}
+
+// Event returns the event referenced by the alert, normalized as an event
+// returned by a search
+func (a AlertEvent) Event() (Event, error) {
+	var ret Event
+	if len(a.DocumentSource) > 0 {
+		err := json.Unmarshal(a.DocumentSource, &ret)
+		if err != nil {
+			return ret, err
+		}
+	}
+	ret.ID = a.DocumentID
+	ret.Raw = a.DocumentSource
+	err := ret.Normalize()
+	return ret, err
+}
@@ -0,0 +1,159 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elastic/go-elasticsearch/v7"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SearchBackend runs searches for a Client. The client handles paging,
+// budgets and timeouts, a backend only needs to run a single request.
+// doctype is empty if the cluster does not use document types.
+type SearchBackend interface {
+	Search(ctx context.Context, index string, doctype string, q Query) (SearchResult, error)
+	Count(ctx context.Context, index string, doctype string, q Query) (int, error)
+}
+
+// requester is implemented by backends that can make arbitrary API
+// requests, which are needed for scroll and point in time paging, version
+// detection and index listing
+type requester interface {
+	request(ctx context.Context, method string, path string, params url.Values, body interface{}) ([]byte, error)
+}
+
+// ErrUnsupported is returned by Client.Request when the backend cannot make
+// arbitrary API requests
+var ErrUnsupported = errors.New("request not supported by the search backend")
+
+// Return the path for an API endpoint on index, including the document
+// type if one is in use
+func indexPath(index string, doctype string, endpoint string) string {
+	if doctype == "" {
+		return "/" + index + "/" + endpoint
+	}
+	return "/" + index + "/" + doctype + "/" + endpoint
+}
+
+// esError is returned when the cluster responds with an error status
+type esError struct {
+	status int
+	body   string
+}
+
+func (e *esError) Error() string {
+	return fmt.Sprintf("elasticsearch returned status %v: %v", e.status, e.body)
+}
+
+// IsIndexNotFound returns true if err is the cluster reporting that the
+// requested index does not exist
+func IsIndexNotFound(err error) bool {
+	var e *esError
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.status == http.StatusNotFound && strings.Contains(e.body, "index_not_found_exception")
+}
+
+// esClient implements SearchBackend using the official client
+type esClient struct {
+	client *elasticsearch.Client
+}
+
+// Search runs the query against index. Point in time searches are not
+// scoped to an index or type in the request path so they are issued
+// directly.
+func (c *esClient) Search(ctx context.Context, index string, doctype string, q Query) (SearchResult, error) {
+	var ret SearchResult
+	path := indexPath(index, doctype, "_search")
+	if q.PIT != nil {
+		path = "/_search"
+	}
+	buf, err := c.request(ctx, "POST", path, nil, q)
+	if err != nil {
+		return ret, err
+	}
+	ret.RawJSON = buf
+	err = json.Unmarshal(buf, &ret)
+	return ret, err
+}
+
+// Count returns the number of documents in index matching the query
+func (c *esClient) Count(ctx context.Context, index string, doctype string, q Query) (int, error) {
+	body := struct {
+		Query interface{} `json:"query"`
+	}{q.Query}
+	buf, err := c.request(ctx, "POST", indexPath(index, doctype, "_count"), nil, body)
+	if err != nil {
+		return 0, err
+	}
+	var res struct {
+		Count int `json:"count"`
+	}
+	err = json.Unmarshal(buf, &res)
+	return res.Count, err
+}
+
+func (c *esClient) request(ctx context.Context, method string, path string, params url.Values, body interface{}) ([]byte, error) {
+	var rdr io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rdr = bytes.NewReader(buf)
+	}
+	u := &url.URL{Path: path, RawQuery: params.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), rdr)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.client.Perform(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		return nil, &esError{status: res.StatusCode, body: string(buf)}
+	}
+	return buf, nil
+}
+
+// openSearchTransport allows the Elasticsearch client to talk to OpenSearch.
+// The client refuses to use a server that does not identify itself as
+// Elasticsearch, OpenSearch does not send the product header so it is added
+// to the responses.
+type openSearchTransport struct {
+	next http.RoundTripper
+}
+
+func (t *openSearchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Header.Get("X-Elastic-Product") == "" {
+		res.Header.Set("X-Elastic-Product", "Elasticsearch")
+	}
+	return res, nil
+}
@@ -0,0 +1,671 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Package mozdefevents searches MozDef events stored in Elasticsearch or
+// OpenSearch, returning normalized events.
+package mozdefevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paging selects how a search fetches the pages of results
+type Paging int
+
+const (
+	// PagingFrom pages with from/size, limited to index.max_result_window
+	PagingFrom Paging = iota
+	// PagingScroll pages with the scroll API
+	PagingScroll
+	// PagingSearchAfter pages with search_after over a point in time
+	PagingSearchAfter
+)
+
+func (p Paging) String() string {
+	switch p {
+	case PagingScroll:
+		return "scroll"
+	case PagingSearchAfter:
+		return "search_after"
+	}
+	return "from"
+}
+
+// Delay before retrying a request on another node, multiplied by the attempt
+const retryBackoff = 250 * time.Millisecond
+
+const (
+	pitKeepAlive    = "5m"
+	scrollKeepAlive = "1m"
+)
+
+// Stats are the resources used by a Client
+type Stats struct {
+	Requests  int
+	Retries   int
+	Documents int
+
+	// Size of the search responses once decompressed
+	ResponseBytes int
+}
+
+// Client searches for events in a cluster, it is configured with options
+// passed to NewClient
+type Client struct {
+	// Version of the cluster, set by DetectVersion or WithVersion
+	Version Version
+
+	paging    Paging
+	pit       bool
+	pageDelay time.Duration
+	reconcile bool
+	warn      func(format string, args ...interface{})
+	logger    *slog.Logger
+	onPage    func(index string, latency time.Duration, documents int, bytes int)
+	timeout   time.Duration
+	budget    int
+	enrichers EnricherChain
+
+	// Settings for the underlying client, only used by NewClient
+	esConfig elasticsearch.Config
+
+	backend SearchBackend
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewClient returns a client for the cluster nodes at addresses, requests
+// are distributed round robin across the nodes and retried on the next node
+// if one is unreachable. No addresses are needed if a backend is given with
+// WithBackend.
+func NewClient(addresses []string, opts ...Option) (*Client, error) {
+	ret := &Client{reconcile: true}
+	ret.esConfig.Addresses = addresses
+	for _, x := range opts {
+		err := x(ret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	escfg := ret.esConfig
+	ret.esConfig = elasticsearch.Config{}
+	if ret.backend != nil {
+		return ret, nil
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no cluster addresses")
+	}
+	if ret.Version.OpenSearch {
+		if escfg.Transport == nil {
+			escfg.Transport = http.DefaultTransport
+		}
+		escfg.Transport = &openSearchTransport{next: escfg.Transport}
+	}
+	escfg.MaxRetries = len(addresses) + 2
+	escfg.RetryBackoff = func(attempt int) time.Duration {
+		ret.mu.Lock()
+		ret.stats.Retries++
+		ret.mu.Unlock()
+		ret.log(slog.LevelDebug, "retrying request", "attempt", attempt)
+		return time.Duration(attempt) * retryBackoff
+	}
+	client, err := elasticsearch.NewClient(escfg)
+	if err != nil {
+		return nil, err
+	}
+	ret.backend = &esClient{client: client}
+	return ret, nil
+}
+
+// Stats returns the resources used by the client so far
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Client) warnf(format string, args ...interface{}) {
+	if c.warn != nil {
+		c.warn(format, args...)
+	}
+}
+
+func (c *Client) log(level slog.Level, msg string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Log(context.Background(), level, msg, args...)
+	}
+}
+
+// Account for a request about to be made, failing once the request budget
+// is exhausted. Requests that release resources on the cluster are always
+// allowed.
+func (c *Client) spend(release bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !release && c.budget > 0 && c.stats.Requests >= c.budget {
+		return fmt.Errorf("request budget of %v exhausted", c.budget)
+	}
+	c.stats.Requests++
+	return nil
+}
+
+// Make a request to the backend with f, applying the request budget and
+// timeout
+func (c *Client) do(ctx context.Context, release bool, f func(ctx context.Context) error) error {
+	err := c.spend(release)
+	if err != nil {
+		return err
+	}
+	rctx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		rctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err = f(rctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if rctx.Err() != nil {
+			return fmt.Errorf("request timed out after %v", c.timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, release bool, method string, path string, params url.Values, body interface{}) ([]byte, error) {
+	r, ok := c.backend.(requester)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	c.log(slog.LevelDebug, "request", "method", method, "path", path, "params", params.Encode())
+	var ret []byte
+	err := c.do(ctx, release, func(ctx context.Context) error {
+		var err error
+		ret, err = r.request(ctx, method, path, params, body)
+		return err
+	})
+	return ret, err
+}
+
+// Request makes a request to the cluster API, returning the response body.
+// If ctx is done the cause of its cancellation is returned. Requests are
+// only supported by the official client backend.
+func (c *Client) Request(ctx context.Context, method string, path string, params url.Values, body interface{}) ([]byte, error) {
+	return c.request(ctx, false, method, path, params, body)
+}
+
+func (c *Client) searchRequest(ctx context.Context, path string, params url.Values, body interface{}) (SearchResult, error) {
+	var ret SearchResult
+	buf, err := c.Request(ctx, "POST", path, params, body)
+	if err != nil {
+		return ret, err
+	}
+	ret.RawJSON = buf
+	err = json.Unmarshal(buf, &ret)
+	return ret, err
+}
+
+// Return the document type to use in requests, clusters without document
+// types select the type in the query instead
+func (c *Client) doctype(doctype string) string {
+	if c.Version.Typeless() {
+		return ""
+	}
+	return doctype
+}
+
+// RequestPath returns the path the client uses for endpoint on index, for
+// example _search or _count. index can be a comma separated list.
+func (c *Client) RequestPath(index string, doctype string, endpoint string) string {
+	return indexPath(index, c.doctype(doctype), endpoint)
+}
+
+// SearchPage runs a single search request against index
+func (c *Client) SearchPage(ctx context.Context, index string, doctype string, q Query) (SearchResult, error) {
+	var ret SearchResult
+	err := c.do(ctx, false, func(ctx context.Context) error {
+		var err error
+		ret, err = c.backend.Search(ctx, index, c.doctype(doctype), q)
+		return err
+	})
+	return ret, err
+}
+
+// SearchIndices runs a single search request against all of indices,
+// skipping any that do not exist. This is used for aggregations, which need
+// to be computed over the whole range rather than merged from per index
+// results.
+func (c *Client) SearchIndices(ctx context.Context, indices []string, doctype string, q Query) (SearchResult, error) {
+	params := url.Values{"ignore_unavailable": []string{"true"}}
+	return c.searchRequest(ctx, indexPath(strings.Join(indices, ","), c.doctype(doctype), "_search"), params, q)
+}
+
+// Count returns the number of documents in index matching the query
+func (c *Client) Count(ctx context.Context, index string, doctype string, q Query) (int, error) {
+	var ret int
+	err := c.do(ctx, false, func(ctx context.Context) error {
+		var err error
+		ret, err = c.backend.Count(ctx, index, c.doctype(doctype), q)
+		return err
+	})
+	return ret, err
+}
+
+// Search runs the query against index, paging through the results and
+// calling handler with the normalized events from each page. An error
+// returned by handler stops the search and is returned.
+func (c *Client) Search(ctx context.Context, index string, doctype string, q Query, handler func([]Event) error) error {
+	return c.SearchFrom(ctx, index, doctype, q, Cursor{}, func(events []Event, _ Cursor) error {
+		return handler(events)
+	})
+}
+
+// Cursor is a position in the results of a search of an index, the offset
+// for from/size paging or the sort values of the last hit for search_after
+// paging. A cursor can be stored to continue an interrupted search later.
+type Cursor struct {
+	From        int           `json:"from,omitempty"`
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+}
+
+// SearchFrom is Search starting at cursor start, with handler also given the
+// cursor following each page. Scroll paging cannot be started at a cursor.
+// The point in time used by search_after paging is opened for the search, so
+// hits with sort values equal to the last hit before the cursor can be
+// repeated or skipped.
+func (c *Client) SearchFrom(ctx context.Context, index string, doctype string, q Query, start Cursor, handler func([]Event, Cursor) error) error {
+	if (start.From != 0 || start.SearchAfter != nil) && c.paging == PagingScroll {
+		return errors.New("a scroll search cannot be started at a cursor")
+	}
+	q.From = start.From
+	q.SearchAfter = start.SearchAfter
+	c.log(slog.LevelInfo, "searching index", "index", index, "paging", c.paging, "pit", c.pit)
+	if c.logger != nil && c.logger.Enabled(ctx, slog.LevelDebug) {
+		buf, err := json.Marshal(q)
+		if err == nil {
+			c.log(slog.LevelDebug, "search query", "index", index, "query", string(buf))
+		}
+	}
+	// search_after paging always uses a point in time so the sort values
+	// refer to a consistent snapshot while events are still being indexed
+	if c.pit || c.paging == PagingSearchAfter {
+		pit, err := c.openPIT(ctx, index)
+		if err != nil {
+			return err
+		}
+		defer c.closePIT(ctx, pit)
+		q.PIT = pit
+	}
+	fetched := start.From
+	scrollID := ""
+	if c.paging == PagingScroll {
+		defer func() {
+			if scrollID != "" {
+				c.clearScroll(ctx, scrollID)
+			}
+		}()
+	}
+	for {
+		if c.pageDelay > 0 && fetched > 0 {
+			err := pause(ctx, c.pageDelay)
+			if err != nil {
+				return err
+			}
+		}
+		var res SearchResult
+		var err error
+		pagestart := time.Now()
+		if c.paging == PagingScroll {
+			res, err = c.scrollPage(ctx, q, index, doctype, scrollID)
+			scrollID = res.ScrollID
+		} else {
+			res, err = c.SearchPage(ctx, index, doctype, q)
+		}
+		if err != nil {
+			return err
+		}
+		if c.onPage != nil {
+			c.onPage(index, time.Since(pagestart), len(res.Hits.Hits), len(res.RawJSON))
+		}
+		c.log(slog.LevelInfo, "fetched page", "index", index, "from", fetched,
+			"hits", len(res.Hits.Hits), "total", int(res.Hits.Total),
+			"latency", time.Since(pagestart).Round(time.Millisecond))
+		if len(res.Hits.Hits) == 0 {
+			break
+		}
+		fetched += len(res.Hits.Hits)
+		c.mu.Lock()
+		c.stats.Documents += len(res.Hits.Hits)
+		c.stats.ResponseBytes += len(res.RawJSON)
+		c.mu.Unlock()
+		results := make([]Event, 0, len(res.Hits.Hits))
+		for _, x := range res.Hits.Hits {
+			nev, err := x.event()
+			if err != nil {
+				return err
+			}
+			err = c.enrichers.Enrich(ctx, &nev)
+			if err != nil {
+				return err
+			}
+			results = append(results, nev)
+		}
+		if c.paging == PagingSearchAfter {
+			// The point in time id can change between requests, and
+			// ES adds an implicit tiebreaker to the sort values
+			if res.PITID != "" {
+				q.PIT.ID = res.PITID
+			}
+			q.SearchAfter = res.Hits.Hits[len(res.Hits.Hits)-1].Sort
+		} else {
+			q.From += q.Size
+		}
+		err = handler(results, Cursor{From: q.From, SearchAfter: q.SearchAfter})
+		if err != nil {
+			return err
+		}
+	}
+	c.log(slog.LevelInfo, "search complete", "index", index, "documents", fetched)
+	// A point in time search is a consistent snapshot, so there is nothing
+	// to reconcile against the live index
+	if q.PIT != nil || !c.reconcile {
+		return nil
+	}
+	c.reconcileCount(ctx, q, index, doctype, fetched)
+	return nil
+}
+
+// Returned by the search handler of an iterator when the caller stops the
+// iteration
+var errStopped = errors.New("iteration stopped")
+
+// IndexError is an error searching a single index
+type IndexError struct {
+	Index string
+	Err   error
+}
+
+func (e *IndexError) Error() string {
+	return e.Index + ": " + e.Err.Error()
+}
+
+func (e *IndexError) Unwrap() error {
+	return e.Err
+}
+
+// Events returns an iterator over the events matching the query in each of
+// indices in turn. Pages are fetched as the iteration proceeds, so only a
+// single page of events is held in memory regardless of the size of the
+// result set.
+//
+// An error is yielded with a zero Event. Errors are returned as an
+// IndexError, and the iteration continues with the next index if the
+// caller does not stop, so a caller can for example skip missing indices.
+func (c *Client) Events(ctx context.Context, indices []string, doctype string, q Query) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		for _, x := range indices {
+			err := c.Search(ctx, x, doctype, q, func(events []Event) error {
+				for _, ev := range events {
+					if !yield(ev, nil) {
+						return errStopped
+					}
+				}
+				return nil
+			})
+			if err == errStopped {
+				return
+			}
+			if err != nil && !yield(Event{}, &IndexError{Index: x, Err: err}) {
+				return
+			}
+		}
+	}
+}
+
+// Sleep for d, returning early if ctx is done
+func pause(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// OpenSearch uses different endpoints to manage point in time searches,
+// though the search itself is the same
+func (c *Client) openPIT(ctx context.Context, index string) (*PointInTime, error) {
+	params := url.Values{"keep_alive": []string{pitKeepAlive}}
+	path := "/" + index + "/_pit"
+	if c.Version.OpenSearch {
+		path = "/" + index + "/_search/point_in_time"
+	}
+	buf, err := c.Request(ctx, "POST", path, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret PointInTime
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return nil, err
+	}
+	if c.Version.OpenSearch {
+		var res struct {
+			ID string `json:"pit_id"`
+		}
+		err = json.Unmarshal(buf, &res)
+		if err != nil {
+			return nil, err
+		}
+		ret.ID = res.ID
+	}
+	if ret.ID == "" {
+		return nil, fmt.Errorf("%v: no point in time id returned", index)
+	}
+	ret.KeepAlive = pitKeepAlive
+	return &ret, nil
+}
+
+func (c *Client) closePIT(ctx context.Context, pit *PointInTime) {
+	var err error
+	if c.Version.OpenSearch {
+		body := struct {
+			ID []string `json:"pit_id"`
+		}{[]string{pit.ID}}
+		_, err = c.request(ctx, true, "DELETE", "/_search/point_in_time", nil, body)
+	} else {
+		body := struct {
+			ID string `json:"id"`
+		}{pit.ID}
+		_, err = c.request(ctx, true, "DELETE", "/_pit", nil, body)
+	}
+	if err != nil {
+		c.warnf("closing point in time: %v", err)
+	}
+}
+
+// Fetch a page of results using the scroll API, which unlike from/size is
+// not limited by index.max_result_window. The first page starts the scroll.
+func (c *Client) scrollPage(ctx context.Context, q Query, index string, doctype string, scrollID string) (SearchResult, error) {
+	if scrollID == "" {
+		params := url.Values{"scroll": []string{scrollKeepAlive}}
+		return c.searchRequest(ctx, indexPath(index, c.doctype(doctype), "_search"), params, q)
+	}
+	body := struct {
+		Scroll   string `json:"scroll"`
+		ScrollID string `json:"scroll_id"`
+	}{scrollKeepAlive, scrollID}
+	return c.searchRequest(ctx, "/_search/scroll", nil, body)
+}
+
+func (c *Client) clearScroll(ctx context.Context, scrollID string) {
+	body := struct {
+		ScrollID []string `json:"scroll_id"`
+	}{[]string{scrollID}}
+	_, err := c.request(ctx, true, "DELETE", "/_search/scroll", nil, body)
+	if err != nil {
+		c.warnf("clearing scroll: %v", err)
+	}
+}
+
+// Compare the number of documents fetched from an index against the count
+// API for the same query, paging with from/size over a live index can skip
+// or duplicate hits if documents are indexed during the run. The check is
+// diagnostic, so a failed count is reported as a warning since the results
+// have already been returned.
+func (c *Client) reconcileCount(ctx context.Context, q Query, index string, doctype string, fetched int) {
+	count, err := c.Count(ctx, index, doctype, q)
+	if err != nil {
+		c.warnf("%v: unable to reconcile document count: %v", index, err)
+		return
+	}
+	c.log(slog.LevelDebug, "reconciled count", "index", index, "fetched", fetched, "count", count)
+	if count != fetched {
+		c.warnf("%v: fetched %v documents but count reports %v, results may be incomplete",
+			index, fetched, count)
+	}
+}
+
+// Version is the version of the cluster, zero if it has not been detected
+// in which case the typed APIs are used
+type Version struct {
+	Major      int
+	Minor      int
+	OpenSearch bool
+}
+
+// AtLeast compares against an ES version, OpenSearch was forked from ES
+// 7.10 and supports the same APIs
+func (v Version) AtLeast(major int, minor int) bool {
+	if v.OpenSearch {
+		return 7 > major || (7 == major && 10 >= minor)
+	}
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// Typeless is true if the cluster has no document types, which were
+// removed in ES 7
+func (v Version) Typeless() bool {
+	return v.AtLeast(7, 0)
+}
+
+// DetectVersion queries the cluster version, which selects between the
+// typed and typeless query paths
+func (c *Client) DetectVersion(ctx context.Context) error {
+	if c.Version.Major != 0 {
+		return nil
+	}
+	buf, err := c.Request(ctx, "GET", "/", nil, nil)
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Version struct {
+			Number       string `json:"number"`
+			Distribution string `json:"distribution"`
+		} `json:"version"`
+	}
+	err = json.Unmarshal(buf, &info)
+	if err != nil {
+		return err
+	}
+	if (info.Version.Distribution == "opensearch") != c.Version.OpenSearch {
+		return fmt.Errorf("cluster distribution is %q, the client is configured for %v",
+			info.Version.Distribution, c.Version.product())
+	}
+	v := Version{OpenSearch: c.Version.OpenSearch}
+	_, err = fmt.Sscanf(info.Version.Number, "%d.%d", &v.Major, &v.Minor)
+	if err != nil || v.Major == 0 {
+		return fmt.Errorf("unable to parse cluster version %q", info.Version.Number)
+	}
+	c.Version = v
+	return nil
+}
+
+func (v Version) product() string {
+	if v.OpenSearch {
+		return "opensearch"
+	}
+	return "elasticsearch"
+}
+
+type SearchHit struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+	Sort   []interface{}   `json:"sort,omitempty"`
+}
+
+// Decode and normalize the event in the hit
+func (h SearchHit) event() (Event, error) {
+	var ret Event
+	err := json.Unmarshal(h.Source, &ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.ID = h.ID
+	ret.Raw = h.Source
+	// Hits from a remote cluster have the cluster name prefixed to the
+	// index
+	if c, _, found := strings.Cut(h.Index, ":"); found {
+		ret.Cluster = c
+	}
+	err = ret.Normalize()
+	return ret, err
+}
+
+// HitsTotal is the total number of hits, ES 7 and later report this as an
+// object while earlier versions use a number
+type HitsTotal int
+
+func (h *HitsTotal) UnmarshalJSON(buf []byte) error {
+	var n int
+	if err := json.Unmarshal(buf, &n); err == nil {
+		*h = HitsTotal(n)
+		return nil
+	}
+	var obj struct {
+		Value int `json:"value"`
+	}
+	err := json.Unmarshal(buf, &obj)
+	if err != nil {
+		return err
+	}
+	*h = HitsTotal(obj.Value)
+	return nil
+}
+
+// SearchResult is the response to a search request
+type SearchResult struct {
+	RawJSON  []byte `json:"-"`
+	Took     int    `json:"took"`
+	TimedOut bool   `json:"timed_out"`
+	Hits     struct {
+		Total HitsTotal   `json:"total"`
+		Hits  []SearchHit `json:"hits"`
+	} `json:"hits"`
+	ScrollID     string          `json:"_scroll_id,omitempty"`
+	PITID        string          `json:"pit_id,omitempty"`
+	Aggregations json.RawMessage `json:"aggregations,omitempty"`
+}
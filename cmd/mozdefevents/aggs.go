@@ -0,0 +1,284 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Convert a search into a date histogram aggregation over the time range,
+// no documents are returned
+func (cfg *config) histogramQuery(qry mozdefevents.Query, interval time.Duration) mozdefevents.Query {
+	qry.Size = 0
+	qry.Sort = nil
+	qry.Aggs = make(map[string]mozdefevents.Aggregation)
+	// interval is deprecated in favor of fixed_interval from ES 7.2
+	agg := &mozdefevents.DateHistogramAgg{Field: cfg.tsField}
+	ivl := fmt.Sprintf("%vs", int64(interval/time.Second))
+	if cfg.esVersion.AtLeast(7, 2) {
+		agg.FixedInterval = ivl
+	} else {
+		agg.Interval = ivl
+	}
+	qry.Aggs["histogram"] = mozdefevents.Aggregation{DateHistogram: agg}
+	return qry
+}
+
+// Run the histogram aggregation against each index, merging the bucket
+// counts and printing the result
+func (cfg *config) runHistogram(qry mozdefevents.Query, doctype string, sparkline bool) error {
+	counts := make(map[int64]int)
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	for _, x := range cfg.indicesForRange(cfg.startDate, cfg.endDate) {
+		res, err := conn.SearchPage(cfg.ctx, x, doctype, qry)
+		if mozdefevents.IsIndexNotFound(err) {
+			skipMissing(x, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var aggs map[string]mozdefevents.AggResult
+		err = json.Unmarshal(res.Aggregations, &aggs)
+		if err != nil {
+			return err
+		}
+		for _, y := range aggs["histogram"].Buckets {
+			key, err := y.Key.Int64()
+			if err != nil {
+				return err
+			}
+			counts[key] += y.DocCount
+			cfg.collected += y.DocCount
+		}
+	}
+	cfg.showHistogram(counts, sparkline)
+	return nil
+}
+
+// Run the search and count the events matched by the mode filter in
+// buckets of interval, aligned to the epoch as a date histogram is. Buckets
+// between the first and last with no events are shown with a zero count.
+func (cfg *config) runHistogramEvents(qry mozdefevents.Query, doctype string, interval time.Duration, sparkline bool) error {
+	counts := make(map[int64]int)
+	ivl := interval.Milliseconds()
+	cfg.sink = func(results []mozdefevents.Event) error {
+		for _, x := range results {
+			ms := x.Time(cfg.tsField).UnixMilli()
+			counts[ms-((ms%ivl)+ivl)%ivl]++
+		}
+		return nil
+	}
+	err := cfg.runQuery(cfg.ctx, qry, doctype)
+	cfg.sink = nil
+	if err != nil && !isInterrupted(err) {
+		return err
+	}
+	if len(counts) > 0 {
+		first, last := int64(math.MaxInt64), int64(math.MinInt64)
+		for k := range counts {
+			first = min(first, k)
+			last = max(last, k)
+		}
+		for k := first; k < last; k += ivl {
+			if _, ok := counts[k]; !ok {
+				counts[k] = 0
+			}
+		}
+	}
+	cfg.showHistogram(counts, sparkline)
+	return err
+}
+
+// Print the histogram bucket counts in time order
+func (cfg *config) showHistogram(counts map[int64]int, sparkline bool) {
+	keys := make([]int64, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	if sparkline {
+		cfg.renderSparkline(os.Stdout, keys, counts)
+		return
+	}
+	for _, x := range keys {
+		fmt.Fprintf(os.Stdout, "%v %v\n", cfg.displayTime(time.UnixMilli(x).UTC()), counts[x])
+	}
+}
+
+// Convert a search into a terms aggregation returning the n most common
+// values of field over the time range
+func topQuery(qry mozdefevents.Query, field string, n int) mozdefevents.Query {
+	qry.Size = 0
+	qry.Sort = nil
+	qry.Aggs = make(map[string]mozdefevents.Aggregation)
+	qry.Aggs["top"] = mozdefevents.Aggregation{
+		Terms: &mozdefevents.TermsAgg{Field: field, Size: n},
+	}
+	return qry
+}
+
+// Convert a search into a cardinality aggregation counting the distinct
+// values of field over the time range
+func uniqueQuery(qry mozdefevents.Query, field string) mozdefevents.Query {
+	qry.Size = 0
+	qry.Sort = nil
+	qry.Aggs = make(map[string]mozdefevents.Aggregation)
+	qry.Aggs["unique"] = mozdefevents.Aggregation{
+		Cardinality: &mozdefevents.CardinalityAgg{Field: field},
+	}
+	return qry
+}
+
+// Search all the indices in the time range with a single request, so
+// aggregations such as terms are computed across the whole range rather
+// than merged from per index results
+func (cfg *config) searchRange(conn *mozdefevents.Client, qry mozdefevents.Query, doctype string) (mozdefevents.SearchResult, error) {
+	return conn.SearchIndices(cfg.ctx, cfg.indicesForRange(cfg.startDate, cfg.endDate), doctype, qry)
+}
+
+// Run the terms aggregation and print the top values with their counts
+func (cfg *config) runTop(qry mozdefevents.Query, doctype string) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	res, err := cfg.searchRange(conn, qry, doctype)
+	if err != nil {
+		return err
+	}
+	var aggs map[string]mozdefevents.AggResult
+	err = json.Unmarshal(res.Aggregations, &aggs)
+	if err != nil {
+		return err
+	}
+	top := aggs["top"]
+	cfg.collected = int(res.Hits.Total)
+	for _, x := range top.Buckets {
+		fmt.Fprintf(os.Stdout, "%8v %v\n", x.DocCount, x.Key)
+	}
+	if top.SumOther > 0 {
+		fmt.Fprintf(os.Stdout, "%8v (other)\n", top.SumOther)
+	}
+	return nil
+}
+
+// Run the cardinality aggregation and print the number of distinct values,
+// ES computes this approximately for high cardinalities
+func (cfg *config) runUnique(qry mozdefevents.Query, doctype string, field string) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	res, err := cfg.searchRange(conn, qry, doctype)
+	if err != nil {
+		return err
+	}
+	var aggs map[string]mozdefevents.AggResult
+	err = json.Unmarshal(res.Aggregations, &aggs)
+	if err != nil {
+		return err
+	}
+	cfg.collected = int(res.Hits.Total)
+	fmt.Fprintf(os.Stdout, "%v distinct values of %v in %v events\n",
+		aggs["unique"].Value, field, cfg.collected)
+	return nil
+}
+
+// Run the search and count the distinct values of field in the events
+// matched by the mode filter, the count is exact
+func (cfg *config) runUniqueEvents(qry mozdefevents.Query, doctype string, field string) error {
+	values := make(map[string]bool)
+	cfg.sink = func(results []mozdefevents.Event) error {
+		for _, x := range results {
+			v, err := x.FieldValue(field)
+			if err != nil {
+				return err
+			}
+			if v != "" {
+				values[v] = true
+			}
+		}
+		return nil
+	}
+	err := cfg.runQuery(cfg.ctx, qry, doctype)
+	cfg.sink = nil
+	if err != nil && !isInterrupted(err) {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%v distinct values of %v in %v events\n",
+		len(values), field, cfg.collected)
+	return err
+}
+
+// Count the events matching the search in each index, printing the count
+// for each index and the total
+func (cfg *config) runCountQuery(qry mozdefevents.Query, doctype string) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	indices := cfg.indicesForRange(cfg.startDate, cfg.endDate)
+	if cfg.checkIndices {
+		indices, err = cfg.existingIndices(indices)
+		if err != nil {
+			return err
+		}
+	}
+	total := 0
+	for _, x := range indices {
+		n, err := conn.Count(cfg.ctx, x, doctype, qry)
+		if mozdefevents.IsIndexNotFound(err) {
+			skipMissing(x, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "%-30v %v\n", x, n)
+		total += n
+	}
+	fmt.Fprintf(os.Stdout, "%-30v %v\n", "total", total)
+	cfg.collected = total
+	return nil
+}
+
+func (cfg *config) renderSparkline(w io.Writer, keys []int64, counts map[int64]int) {
+	if len(keys) == 0 {
+		return
+	}
+	max := 0
+	for _, x := range keys {
+		if counts[x] > max {
+			max = counts[x]
+		}
+	}
+	var line strings.Builder
+	for _, x := range keys {
+		i := 0
+		if max > 0 {
+			i = counts[x] * (len(sparkTicks) - 1) / max
+		}
+		line.WriteRune(sparkTicks[i])
+	}
+	fmt.Fprintf(w, "%v %v max %v\n%v\n", cfg.displayTime(time.UnixMilli(keys[0]).UTC()),
+		cfg.displayTime(time.UnixMilli(keys[len(keys)-1]).UTC()), max, line.String())
+}
@@ -0,0 +1,113 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+)
+
+// MozDef writes alerts to monthly indices
+const defaultAlertIndexPattern = "alerts-%Y%m"
+
+// Set the default value of flag name, used where a subcommand shares flags
+// with the event searches but needs a different default
+func setFlagDefault(fs *flag.FlagSet, name string, value string) {
+	f := fs.Lookup(name)
+	f.DefValue = value
+	f.Value.Set(value)
+}
+
+func (cfg *config) buildAlertSearch(category string) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	if category != "" {
+		ret.AddMatch("category", category)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show alerts with the number of events that triggered each, and with
+// -events the events themselves
+func (cfg *config) alertResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		a, err := mozdefevents.ParseAlert(x)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: alert %v: %v\n", x.ID, err)
+			continue
+		}
+		category := a.Category
+		if category == "" {
+			category = "unknown"
+		}
+		severity := a.Severity
+		if severity == "" {
+			severity = "unknown"
+		}
+		fmt.Fprintf(os.Stdout, "%v [alert] (%v/%v) %v events:%v\n", cfg.displayTime(a.UTCTimestamp),
+			category, severity, a.Summary, len(a.Events))
+		if !cfg.alertEvents {
+			continue
+		}
+		for _, y := range a.Events {
+			e, err := y.Event()
+			if err != nil {
+				fmt.Fprintf(os.Stdout, "    %v/%v unable to decode event: %v\n", y.DocumentIndex, y.DocumentID, err)
+				continue
+			}
+			host := e.Hostname
+			if host == "" {
+				host = e.Details.Hostname
+			}
+			fmt.Fprintf(os.Stdout, "    %v/%v %v %v\n", y.DocumentIndex, y.DocumentID, host, e.Summary)
+		}
+	}
+}
+
+func (cfg *config) runAlerts(args []string) error {
+	fs := cfg.newFlagSet("alerts", "", "Search the MozDef alerts indices, showing the category, severity and summary of\n"+
+		"each alert and the number of events that triggered it.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	setFlagDefault(fs, "index-pattern", envDefault("", cfg.file.AlertIndexPattern, defaultAlertIndexPattern))
+	setFlagDefault(fs, "alias", cfg.file.AlertAlias)
+	category := fs.String("category", "", "match alerts with category")
+	events := fs.Bool("events", false, "also show the events that triggered each alert")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	// Remote clusters are searched with the same alert indices as the
+	// local cluster
+	for i := range cfg.remotes {
+		cfg.remotes[i].pattern = cfg.indexPattern
+		cfg.remotes[i].alias = cfg.alias
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEALERTS
+	cfg.alertEvents = *events
+	cfg.extraFields = mozdefevents.AlertSourceFields
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildAlertSearch(*category)
+	}
+	return cfg.runSearch(so, eo, "alerts", build, "")
+}
@@ -0,0 +1,155 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"time"
+)
+
+// checkpoint is the progress of a search saved to a state file with
+// -resume, written after each page of events is output so an interrupted
+// export can continue from the page following the last one written
+type checkpoint struct {
+	Search    string              `json:"search"`
+	Completed []string            `json:"completed"`
+	Index     string              `json:"index,omitempty"`
+	Cursor    mozdefevents.Cursor `json:"cursor"`
+	Collected int                 `json:"collected"`
+	Done      bool                `json:"done"`
+	Updated   time.Time           `json:"updated"`
+
+	path string
+}
+
+// Return an identifier for the search, so a state file is only used to
+// resume the search it was written for
+func searchFingerprint(qry mozdefevents.Query, indices []string, doctype string) (string, error) {
+	buf, err := json.Marshal(struct {
+		Query   mozdefevents.Query `json:"query"`
+		Indices []string           `json:"indices"`
+		Doctype string             `json:"doctype"`
+	}{qry, indices, doctype})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Load the state file at path, or return a new checkpoint if it does not
+// exist yet
+func loadCheckpoint(path string, search string) (*checkpoint, error) {
+	ret := &checkpoint{path: path, Search: search}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	// Sort values are kept as numbers so large values such as the
+	// tiebreaker are not rounded
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err = dec.Decode(ret)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if ret.Search != search {
+		return nil, fmt.Errorf("%v is the state of a different search, the query, time range and "+
+			"indices must be the same to resume", path)
+	}
+	return ret, nil
+}
+
+// Write the checkpoint, replacing the state file so an interruption while
+// writing leaves the previous state in place
+func (c *checkpoint) save() error {
+	c.Updated = time.Now().UTC()
+	buf, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmppath := c.path + ".tmp"
+	err = os.WriteFile(tmppath, append(buf, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmppath, c.path)
+}
+
+// Search the indices in turn, skipping those completed by an earlier run
+// and starting the index in progress at the saved cursor. The checkpoint is
+// saved after each page is handled.
+func (cfg *config) runQueryCheckpoint(ctx context.Context, qry mozdefevents.Query, indices []string, doctype string) error {
+	cp := cfg.checkpoint
+	if cp.Done {
+		fmt.Fprintf(os.Stderr, "notice: search in %v is complete, nothing to resume\n", cp.path)
+		return nil
+	}
+	completed := make(map[string]bool)
+	for _, x := range cp.Completed {
+		completed[x] = true
+	}
+	if len(completed) > 0 || cp.Index != "" {
+		fmt.Fprintf(os.Stderr, "notice: resuming search from %v, %v indices complete, %v events output\n",
+			cp.path, len(completed), cp.Collected)
+	}
+	cfg.collected = cp.Collected
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	for _, x := range indices {
+		if completed[x] {
+			continue
+		}
+		var start mozdefevents.Cursor
+		if cp.Index == x {
+			start = cp.Cursor
+		}
+		err = conn.SearchFrom(ctx, x, doctype, qry, start, func(results []mozdefevents.Event, next mozdefevents.Cursor) error {
+			herr := cfg.handleResults(results)
+			if herr != nil && herr != errLimitReached {
+				return herr
+			}
+			cp.Index = x
+			cp.Cursor = next
+			cp.Collected = cfg.collected
+			cp.Done = herr == errLimitReached
+			err := cp.save()
+			if err != nil {
+				return err
+			}
+			return herr
+		})
+		if err == errLimitReached {
+			return err
+		}
+		if err != nil && skipMissing(x, err) != nil {
+			return err
+		}
+		cp.Completed = append(cp.Completed, x)
+		cp.Index = ""
+		cp.Cursor = mozdefevents.Cursor{}
+		err = cp.save()
+		if err != nil {
+			return err
+		}
+	}
+	cp.Done = true
+	return cp.save()
+}
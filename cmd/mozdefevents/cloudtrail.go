@@ -0,0 +1,134 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+)
+
+// cloudtrailFilter holds the criteria of the cloudtrail subcommand
+type cloudtrailFilter struct {
+	event  string
+	arn    string
+	region string
+	failed bool
+}
+
+// Return the ARN of the identity that made a CloudTrail request
+func cloudtrailARN(d mozdefevents.EventDetails) string {
+	if d.UserIdentity == nil {
+		return ""
+	}
+	return d.UserIdentity.ARN
+}
+
+// Match events exactly on the criteria, the search matches the analyzed
+// fields
+func (f cloudtrailFilter) match(e mozdefevents.Event) bool {
+	d := e.Details
+	switch {
+	case f.event != "" && d.EventName != f.event:
+		return false
+	case f.arn != "" && cloudtrailARN(d) != f.arn:
+		return false
+	case f.region != "" && d.AWSRegion != f.region:
+		return false
+	case f.failed && d.ErrorCode == "":
+		return false
+	}
+	return true
+}
+
+func (cfg *config) buildCloudTrailSearch(f cloudtrailFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("cloudtrail", cfg.esVersion)
+	if f.event != "" {
+		ret.AddMatch("details.eventname", f.event)
+	}
+	if f.arn != "" {
+		ret.AddMatch("details.useridentity.arn", f.arn)
+	}
+	if f.region != "" {
+		ret.AddMatch("details.awsregion", f.region)
+	}
+	if f.failed {
+		ret.AddExists("details.errorcode")
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show CloudTrail events with the region, event name, identity and source
+// address of each request
+func (cfg *config) cloudtrailResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		region := d.AWSRegion
+		if region == "" {
+			region = "unknown"
+		}
+		name := d.EventName
+		if name == "" {
+			name = "unknown"
+		}
+		arn := cloudtrailARN(d)
+		if arn == "" {
+			arn = "none"
+		}
+		evstr := fmt.Sprintf("[cloudtrail] %v %v arn:%v", region, name, arn)
+		if d.SourceIPAddress != "" {
+			evstr += " from:" + d.SourceIPAddress
+		}
+		if d.ErrorCode != "" {
+			evstr += " error:" + d.ErrorCode
+		}
+		host := x.Hostname
+		if host == "" {
+			host = "-"
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+func (cfg *config) runCloudTrail(args []string) error {
+	fs := cfg.newFlagSet("cloudtrail", "", "Search for AWS CloudTrail events, showing the region, event name, identity\n"+
+		"ARN, source address and error code of each request.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f cloudtrailFilter
+	fs.StringVar(&f.event, "event", "", "match events with event name (e.g., ConsoleLogin)")
+	fs.StringVar(&f.arn, "arn", "", "match events for identity ARN")
+	fs.StringVar(&f.region, "region", "", "match events in region")
+	fs.BoolVar(&f.failed, "errors", false, "only match requests that failed with an error code")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODECLOUDTRAIL
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildCloudTrailSearch(f)
+	}
+	return cfg.runSearch(so, eo, "cloudtrail", build, "cloudtrail")
+}
@@ -0,0 +1,808 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// subcommand is a mode of operation selected by the first argument
+type subcommand struct {
+	name string
+	desc string
+	run  func(cfg *config, args []string) error
+}
+
+var subcommands []subcommand
+
+// The table is set in init as the completion subcommand refers to it
+func init() {
+	subcommands = []subcommand{
+		{"audit", "search for audit events", (*config).runAudit},
+		{"syslog", "search for syslog events", (*config).runSyslog},
+		{"ssh", "search for ssh authentication attempts", (*config).runSSH},
+		{"sudo", "search for commands run with sudo", (*config).runSudo},
+		{"firewall", "search for firewall connection events", (*config).runFirewall},
+		{"zeek", "search for zeek (bro) events", (*config).runZeek},
+		{"cloudtrail", "search for aws cloudtrail events", (*config).runCloudTrail},
+		{"guardduty", "search for aws guardduty findings", (*config).runGuardDuty},
+		{"windows", "search for windows event log events", (*config).runWindows},
+		{"dns", "search for dns query events", (*config).runDNS},
+		{"alerts", "search for mozdef alerts", (*config).runAlerts},
+		{"mfa", "search for duo and other mfa authentication events", (*config).runMFA},
+		{"ossec", "search for ossec and wazuh alerts", (*config).runOSSEC},
+		{"proxy", "search for web proxy access events", (*config).runProxy},
+		{"vpn", "search for openvpn session events", (*config).runVPN},
+		{"fail2ban", "search for fail2ban and brute force authentication events", (*config).runFail2ban},
+		{"query", "search for events of any type", (*config).runQueryCommand},
+		{"multi", "search several modes at once, merging the results", (*config).runMulti},
+		{"count", "count the events matching a search", (*config).runCount},
+		{"top", "show the most common values of a field in matching events", (*config).runTopCommand},
+		{"inspect", "sample documents and report the fields present", (*config).runInspect},
+		{"saved", "save, list, run and delete named searches", (*config).runSaved},
+		{"daemon", "run searches on a schedule", (*config).runDaemon},
+		{"serve", "serve searches over an HTTP API", (*config).runServe},
+		{"exporter", "expose event counts as Prometheus metrics", (*config).runExporter},
+		{"grpc", "serve a gRPC service streaming events", (*config).runGRPC},
+		{"completion", "print a shell completion script for bash, zsh or fish", (*config).runCompletion},
+	}
+}
+
+// Return a flag set for a subcommand, the usage message shows the arguments
+// and description of the subcommand before the flags
+func (cfg *config) newFlagSet(name string, args string, desc string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if args != "" {
+		args = " " + args
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: mozdefevents %v [flags]%v\n\n%v\n\nflags:\n", name, args, desc)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Returned by parseFlags when the flag set of a subcommand has been
+// collected rather than parsed
+var errFlagsCollected = errors.New("flags collected")
+
+// Parse the flags of a subcommand. When generating shell completions the
+// flag set is collected instead and errFlagsCollected returned, so the
+// subcommand stops without running. The flag package reports parse errors
+// itself, so errUsage is returned for them.
+func (cfg *config) parseFlags(fs *flag.FlagSet, args []string) error {
+	if cfg.flagSets != nil {
+		cfg.flagSets[fs.Name()] = fs
+		return errFlagsCollected
+	}
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return errHelp
+	}
+	if err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// Return errNoResults if the search matched no events
+func (cfg *config) matched() error {
+	if cfg.collected == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// searchOptions are the flags shared by the subcommands that search events
+type searchOptions struct {
+	connopts     connOptions
+	tz           *string
+	begindate    *string
+	last         *string
+	enddate      *string
+	force        *bool
+	indexpat     *string
+	alias        *string
+	remotes      stringList
+	noop         *bool
+	curl         *bool
+	hostmatch    stringList
+	hostnocase   *bool
+	hostfile     *string
+	rangeflt     *string
+	origuser     *string
+	tags         stringList
+	groups       stringList
+	severity     *string
+	keyword      *string
+	clampstart   *bool
+	checkindices *bool
+	queryfile    *string
+	paging       *string
+	usepit       *bool
+	filternames  stringList
+	filterfile   *string
+	parallel     *int
+	nice         *bool
+	budget       *int
+	minshould    *int
+	raw          *bool
+	nestedpath   *string
+	timing       *bool
+	stats        *bool
+	metafile     *string
+	tsfield      *string
+}
+
+func (cfg *config) addSearchFlags(fs *flag.FlagSet) *searchOptions {
+	o := &searchOptions{}
+	o.tz = fs.String("tz", "", "time zone for date input and output (e.g., America/Los_Angeles, defaults to TZ or UTC)")
+	o.begindate = fs.String("b", "", "start date for search in UTC or -tz zone (yyyy-mm-dd hh:mm:ss, epoch, now, or relative such as -24h or -7d)")
+	fs.String("config", defaultConfigPath(), "configuration file")
+	fs.String("profile", "", "use named profile from configuration file")
+	o.last = fs.String("last", cfg.file.Last, "search the window preceding now (e.g., 4h, 3d), instead of -b and -e")
+	o.enddate = fs.String("e", "", "end date for search in UTC or -tz zone (yyyy-mm-dd hh:mm:ss, epoch, now, or relative, defaults to now)")
+	o.force = fs.Bool("force", false, "allow searches over very large time ranges")
+	o.indexpat = fs.String("index-pattern", envDefault("", cfg.file.IndexPattern, defaultIndexPattern),
+		"daily index name pattern, strftime (e.g., events-%Y.%m.%d), a Go layout prefixed with layout:, or a static index or alias name")
+	o.alias = fs.String("alias", cfg.file.Alias, "search a single index or alias instead of daily indices, overrides -index-pattern")
+	fs.Var(&o.remotes, "remote", "also search remote cluster configured for cross cluster search (repeatable), each day is shown a cluster at a time")
+	o.connopts.addFlags(fs, cfg.file)
+	o.noop = fs.Bool("n", false, "dont search, print the query, doctype and the request for each index and exit")
+	o.curl = fs.Bool("curl", false, "with -n, also print an equivalent curl command for each request")
+	fs.Var(&o.hostmatch, "H", "match events for hostname matching regexp (repeatable or comma separated)")
+	o.hostnocase = fs.Bool("i", false, "case insensitive hostname matching")
+	o.hostfile = fs.String("Hfile", "", "read hostname match regexps from file, one per line")
+	o.rangeflt = fs.String("range", "", "numeric range filter on field (field:gte:lte, either bound optional)")
+	o.origuser = fs.String("origuser", "", "match events where original user (suser) is user")
+	fs.Var(&o.tags, "tag", "match events with tag (repeatable)")
+	fs.Var(&o.groups, "group", "match events from hosts in MozDef asset group or tag (repeatable, any matches)")
+	o.severity = fs.String("severity", "", "match events with severity, suffix with + to include higher (e.g., warning+)")
+	o.keyword = fs.String("k", "", "match events with summary matching keyword")
+	o.clampstart = fs.Bool("clamp", false, "clamp start date to oldest available index, without it only start dates over 7d ago are checked and warned of")
+	o.checkindices = fs.Bool("check-indices", false, "check which daily indices exist before searching")
+	o.queryfile = fs.String("query-file", "", "merge ES query DSL from file with generated clauses")
+	o.paging = fs.String("paging", "from", "pagination strategy, from (from/size, limited to max_result_window), "+
+		"scroll, or search_after (point in time, ES 7.10+)")
+	o.usepit = fs.Bool("pit", false, "use a point in time per index for a consistent snapshot (ES 7.10+)")
+	fs.Var(&o.filternames, "filter", "apply named filter set from filter file (repeatable)")
+	o.filterfile = fs.String("filterfile", defaultFilterPath(), "path to named filter definitions")
+	o.parallel = fs.Int("parallel", 1, "number of daily indices to query concurrently")
+	o.nice = fs.Bool("nice", false, "reduce load on the cluster with smaller pages and delays between fetches")
+	o.budget = fs.Int("budget", 0, "maximum number of requests to issue to ES (0 for unlimited)")
+	o.minshould = fs.Int("minshould", 0, "override minimum_should_match for generated should clauses")
+	o.raw = fs.Bool("raw", false, "fetch complete documents instead of only the fields used")
+	o.nestedpath = fs.String("nested", "", "wrap criteria on fields under path in nested queries (e.g., details)")
+	o.timing = fs.Bool("timing", false, "print per index query latency, pages, documents and bytes to stderr at the end of the run")
+	o.stats = fs.Bool("stats", false, "print resource usage summary to stderr at the end of the run")
+	o.metafile = fs.String("meta", "", "write run metadata including resource usage as json to file")
+	o.tsfield = fs.String("tsfield", "utctimestamp", "timestamp field used for the time range and sort (utctimestamp or receivedtimestamp)")
+	return o
+}
+
+// Apply the search flags to the configuration
+func (o *searchOptions) apply(cfg *config) error {
+	if *o.curl && !*o.noop {
+		return errors.New("-curl can only be used with -n")
+	}
+	err := cfg.configureConn(o.connopts)
+	if err != nil {
+		return err
+	}
+	cfg.location, err = loadLocation(*o.tz)
+	if err != nil {
+		return err
+	}
+	if *o.last != "" {
+		err = cfg.parseLast(*o.last, *o.begindate, *o.enddate)
+	} else {
+		err = cfg.parseDates(*o.begindate, *o.enddate)
+	}
+	if err != nil {
+		return err
+	}
+	err = cfg.validateDates(*o.force)
+	if err != nil {
+		return err
+	}
+	cfg.force = *o.force
+	cfg.hostmatch = o.hostmatch
+	cfg.hostnocase = *o.hostnocase
+	if *o.hostfile != "" {
+		hosts, err := readHostFile(*o.hostfile)
+		if err != nil {
+			return err
+		}
+		cfg.hostmatch = append(cfg.hostmatch, hosts...)
+	}
+	cfg.keyword = *o.keyword
+	cfg.tags = o.tags
+	cfg.groups = o.groups
+	cfg.origuser = *o.origuser
+	if *o.severity != "" {
+		cfg.severity, err = parseSeverity(*o.severity)
+		if err != nil {
+			return err
+		}
+	}
+	cfg.clampStart = *o.clampstart
+	cfg.raw = *o.raw
+	if *o.timing {
+		cfg.timing = newTimingReport()
+	}
+	cfg.checkIndices = *o.checkindices
+	err = cfg.setIndexPattern(*o.indexpat, *o.alias)
+	if err != nil {
+		return err
+	}
+	remotes := o.remotes
+	if len(remotes) == 0 {
+		remotes = cfg.file.Remotes
+	}
+	err = cfg.setRemotes(remotes)
+	if err != nil {
+		return err
+	}
+	cfg.usePIT = *o.usepit
+	switch *o.paging {
+	case "from":
+		cfg.paging = mozdefevents.PagingFrom
+	case "scroll":
+		cfg.paging = mozdefevents.PagingScroll
+		if cfg.usePIT {
+			return errors.New("-pit cannot be used with scroll paging")
+		}
+	case "search_after":
+		cfg.paging = mozdefevents.PagingSearchAfter
+	default:
+		return errors.New("-paging must be from, scroll or search_after")
+	}
+	if *o.tsfield != "utctimestamp" && *o.tsfield != "receivedtimestamp" {
+		return errors.New("-tsfield must be utctimestamp or receivedtimestamp")
+	}
+	cfg.tsField = *o.tsfield
+	cfg.sortField = cfg.tsField
+	cfg.sortOrder = "asc"
+	if *o.parallel < 1 {
+		return errors.New("-parallel must be at least 1")
+	}
+	if *o.parallel > 1 && *o.nice {
+		return errors.New("-parallel cannot be used with -nice")
+	}
+	cfg.parallel = *o.parallel
+	cfg.pageSize = docsPerSearch
+	if *o.nice {
+		cfg.pageSize = niceDocsPerSearch
+		cfg.pageDelay = nicePageDelay
+	}
+	if *o.budget < 0 {
+		return errors.New("-budget must not be negative")
+	}
+	cfg.requestBudget = *o.budget
+	if *o.minshould < 0 {
+		return errors.New("-minshould must not be negative")
+	}
+	cfg.minShouldMatch = *o.minshould
+	cfg.nestedPath = strings.TrimSuffix(*o.nestedpath, ".")
+	if len(o.filternames) > 0 {
+		cfg.filters, err = resolveFilters(*o.filterfile, o.filternames)
+		if err != nil {
+			return err
+		}
+	}
+	if *o.queryfile != "" {
+		cfg.userquery, err = readQueryFile(*o.queryfile)
+		if err != nil {
+			return err
+		}
+	}
+	if *o.rangeflt != "" {
+		cfg.rangeflt, err = parseRangeFilter(*o.rangeflt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prepare the connection for the search, unless the query is only being
+// printed
+func (o *searchOptions) connect(cfg *config) error {
+	if *o.noop {
+		return nil
+	}
+	err := cfg.detectVersion()
+	if err != nil {
+		return err
+	}
+	return cfg.checkRetention()
+}
+
+// Print the query and the requests that would be made if -n was given,
+// returning true if the search should not be run
+func (o *searchOptions) printQuery(cfg *config, qry mozdefevents.Query, doctype string, reqs noopRequests) (bool, error) {
+	if !*o.noop {
+		return false, nil
+	}
+	buf, err := json.MarshalIndent(qry, "", "    ")
+	if err != nil {
+		return true, err
+	}
+	fmt.Fprintf(os.Stdout, "%v\n", string(buf))
+	return true, cfg.printRequests(os.Stdout, qry, doctype, reqs, *o.curl)
+}
+
+// Report the timing and resource usage of the run as requested
+func (o *searchOptions) finish(cfg *config, mode string) error {
+	if cfg.timing != nil {
+		cfg.timing.render(os.Stderr)
+	}
+	if *o.stats {
+		cfg.renderUsage(os.Stderr)
+	}
+	if *o.metafile != "" {
+		return cfg.writeMeta(*o.metafile, mode)
+	}
+	return nil
+}
+
+// eventOptions are the flags for the subcommands that output events
+type eventOptions struct {
+	tagcountmode *bool
+	heatmapmode  *bool
+	contextwin   *time.Duration
+	csvout       *bool
+	limit        *int
+	dedupkey     stringList
+	enrichers    stringList
+	output       *string
+	histogram    *string
+	sparkline    *bool
+	unique       *string
+	follow       *bool
+	sortspec     *string
+	runid        *string
+	diffagainst  *string
+	tui          *bool
+	resume       *string
+
+	// Only available for audit events, set by the audit subcommand
+	groupses *bool
+
+	histinterval time.Duration
+}
+
+func (cfg *config) addEventFlags(fs *flag.FlagSet) *eventOptions {
+	o := &eventOptions{groupses: new(bool)}
+	o.tagcountmode = fs.Bool("tagcounts", false, "show event counts per tag and asset group instead of events")
+	o.heatmapmode = fs.Bool("heatmap", false, "show host by hour of day activity matrix instead of events")
+	o.contextwin = fs.Duration("context", 0, "show events on the same host within duration of each match (e.g., 5m)")
+	o.csvout = fs.Bool("csv", false, "output heatmap as csv")
+	o.limit = fs.Int("limit", 0, "stop after limit events have been collected (0 for no limit)")
+	fs.Var(&o.dedupkey, "dedup-key", "collapse events with the same values for fields, showing counts (comma separated)")
+	fs.Var(&o.enrichers, "enrich", "run enrichers on events in order (comma separated, e.g., geoip,rdns,asset,scoring)")
+	o.output = fs.String("output", cfg.file.Output, "stream results as ndjson to unix:/path socket or fifo:/path named pipe")
+	o.histogram = fs.String("histogram", "", "show event counts per interval (e.g., 1h) instead of events")
+	o.sparkline = fs.Bool("sparkline", false, "show histogram as a sparkline")
+	o.unique = fs.String("unique", "", "show the number of distinct values of field instead of events (e.g., hostname)")
+	o.follow = fs.Bool("f", false, "after searching, keep polling for and printing new events, events indexed over 2m late are missed")
+	o.sortspec = fs.String("sort", "", "sort results by field (field:asc|desc, defaults to timestamp field ascending), fields other than the timestamp are sorted within each daily index")
+	o.runid = fs.String("run-id", "", "store the document ids from this run under id")
+	o.diffagainst = fs.String("diff-against", "", "only report events not present in stored run id")
+	o.tui = fs.Bool("tui", false, "browse the results interactively in a terminal interface")
+	o.resume = fs.String("resume", "", "save progress to state file after each page, resuming an interrupted search from it")
+	return o
+}
+
+// Apply the event output flags to the configuration, checking the output
+// modes requested can be combined. The search flags must already have been
+// applied.
+func (o *eventOptions) apply(cfg *config, noop bool) error {
+	var err error
+	cfg.runid = *o.runid
+	if *o.sortspec != "" {
+		cfg.sortField, cfg.sortOrder, err = parseSort(*o.sortspec)
+		if err != nil {
+			return err
+		}
+	}
+	groupses := *o.groupses
+	if *o.histogram != "" {
+		o.histinterval, err = parseDuration(*o.histogram)
+		if err != nil {
+			return err
+		}
+		if o.histinterval < time.Second {
+			return errors.New("-histogram interval must be at least 1s")
+		}
+		if *o.follow || *o.heatmapmode || *o.tagcountmode || groupses || *o.contextwin > 0 || len(o.dedupkey) > 0 {
+			return errors.New("-histogram cannot be combined with other output modes")
+		}
+	}
+	if *o.unique != "" {
+		if *o.histogram != "" || *o.follow || *o.heatmapmode || *o.tagcountmode || groupses || *o.contextwin > 0 || len(o.dedupkey) > 0 {
+			return errors.New("-unique cannot be combined with other output modes")
+		}
+	}
+	if *o.follow {
+		if cfg.sortField != cfg.tsField || cfg.sortOrder != "asc" {
+			return errors.New("-f requires results sorted ascending by the timestamp field")
+		}
+		if *o.heatmapmode || *o.tagcountmode || groupses || *o.contextwin > 0 || len(o.dedupkey) > 0 || *o.limit > 0 {
+			return errors.New("-f cannot be combined with aggregating output modes or -limit")
+		}
+		cfg.follow = &followState{}
+	}
+	if *o.tui {
+		if *o.histogram != "" || *o.unique != "" || *o.follow || *o.heatmapmode || *o.tagcountmode || groupses ||
+			*o.contextwin > 0 || len(o.dedupkey) > 0 || *o.output != "" {
+			return errors.New("-tui cannot be combined with other output modes")
+		}
+		if !noop && (!term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd()))) {
+			return errors.New("-tui requires a terminal")
+		}
+		cfg.tui = &tuiState{}
+	}
+	if *o.resume != "" {
+		if *o.histogram != "" || *o.unique != "" || *o.follow || *o.heatmapmode || *o.tagcountmode || groupses ||
+			*o.contextwin > 0 || len(o.dedupkey) > 0 || *o.tui {
+			return errors.New("-resume cannot be combined with other output modes")
+		}
+		if cfg.parallel > 1 || cfg.paging == mozdefevents.PagingScroll {
+			return errors.New("-resume cannot be used with -parallel or scroll paging")
+		}
+	}
+	if *o.limit < 0 {
+		return errors.New("-limit must not be negative")
+	}
+	cfg.limit = *o.limit
+	if *o.output != "" && !noop {
+		cfg.output, err = openOutput(*o.output)
+		if err != nil {
+			return err
+		}
+	}
+	enrichers := o.enrichers
+	if len(enrichers) == 0 {
+		enrichers = cfg.file.Enrich
+	}
+	cfg.registerEnrichers()
+	cfg.enrichers, err = mozdefevents.NewEnricherChain(enrichers)
+	if err != nil {
+		return err
+	}
+	if *o.heatmapmode {
+		cfg.heatmap = make(heatmap)
+	}
+	if *o.contextwin < 0 {
+		return errors.New("-context must not be negative")
+	}
+	if *o.contextwin > 0 && *o.heatmapmode {
+		return errors.New("-context and -heatmap cannot be combined")
+	}
+	cfg.context = *o.contextwin
+	if groupses && (*o.contextwin > 0 || *o.heatmapmode) {
+		return errors.New("-groupses cannot be combined with -context or -heatmap")
+	}
+	if *o.tagcountmode && (groupses || *o.contextwin > 0 || *o.heatmapmode) {
+		return errors.New("-tagcounts cannot be combined with -groupses, -context or -heatmap")
+	}
+	if *o.tagcountmode {
+		cfg.tagCounts = make(tagCounts)
+	}
+	if len(o.dedupkey) > 0 && (*o.tagcountmode || groupses || *o.contextwin > 0 || *o.heatmapmode) {
+		return errors.New("-dedup-key cannot be combined with -tagcounts, -groupses, -context or -heatmap")
+	}
+	if len(o.dedupkey) > 0 {
+		cfg.dedup = newDedupGroups(o.dedupkey)
+	}
+	if groupses {
+		cfg.sessions = newSessionGroups()
+	}
+	if *o.diffagainst != "" {
+		cfg.prevrun, err = loadRun(*o.diffagainst)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run an event search with the query from build, showing the events or
+// the aggregation requested by the output flags
+func (cfg *config) runSearch(so *searchOptions, eo *eventOptions, mode string, build func() (mozdefevents.Query, error), doctype string) error {
+	if cfg.output != nil {
+		defer cfg.output.Close()
+	}
+	err := so.connect(cfg)
+	if err != nil {
+		return err
+	}
+	// A mode that matches the returned events with eventFilter computes the
+	// histogram or distinct count from the matched events, since a server
+	// side aggregation would also count the events the filter excludes
+	filtered := cfg.eventFilter != nil
+	if filtered && *eo.unique != "" {
+		cfg.extraFields = append(cfg.extraFields, *eo.unique)
+	}
+	qry, err := build()
+	if err != nil {
+		return err
+	}
+	if eo.histinterval > 0 && !filtered {
+		qry = cfg.histogramQuery(qry, eo.histinterval)
+	}
+	if *eo.unique != "" && !filtered {
+		qry = uniqueQuery(qry, *eo.unique)
+	}
+	reqs := noopRequests{endpoint: "_search", indices: cfg.searchOrder()}
+	if *eo.unique != "" && !filtered {
+		reqs.combined = true
+	}
+	if done, err := so.printQuery(cfg, qry, doctype, reqs); done {
+		return err
+	}
+	if *eo.resume != "" {
+		search, err := searchFingerprint(qry, reqs.indices, doctype)
+		if err != nil {
+			return err
+		}
+		cfg.checkpoint, err = loadCheckpoint(*eo.resume, search)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case eo.histinterval > 0 && filtered:
+		err = cfg.runHistogramEvents(qry, doctype, eo.histinterval, *eo.sparkline)
+	case eo.histinterval > 0:
+		err = cfg.runHistogram(qry, doctype, *eo.sparkline)
+	case *eo.unique != "" && filtered:
+		err = cfg.runUniqueEvents(qry, doctype, *eo.unique)
+	case *eo.unique != "":
+		err = cfg.runUnique(qry, doctype, *eo.unique)
+	case cfg.tui != nil:
+		err = cfg.runTUI(build, doctype)
+	default:
+		err = cfg.runQuery(cfg.ctx, qry, doctype)
+	}
+	if err == nil && cfg.follow != nil {
+		err = cfg.followQuery(build, doctype)
+	}
+	// An interrupted search still renders and reports what was collected
+	// before returning the interruption
+	if err != nil && !isInterrupted(err) {
+		return err
+	}
+	serr := cfg.renderCollected(eo)
+	if serr == nil {
+		serr = so.finish(cfg, mode)
+	}
+	if serr != nil {
+		return serr
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.matched()
+}
+
+// Render the results accumulated over the search and save the run
+func (cfg *config) renderCollected(eo *eventOptions) error {
+
+	if cfg.tagCounts != nil {
+		cfg.tagCounts.render(os.Stdout)
+	}
+
+	if cfg.findings != nil {
+		cfg.renderFindings()
+	}
+
+	if cfg.bruteSources != nil {
+		cfg.bruteSources.render(os.Stdout, cfg)
+	}
+
+	if cfg.heatmap != nil {
+		if *eo.csvout {
+			err := cfg.heatmap.renderCSV(os.Stdout)
+			if err != nil {
+				return err
+			}
+		} else {
+			cfg.heatmap.render(os.Stdout)
+		}
+	}
+
+	if cfg.runid != "" {
+		return saveRun(cfg.runid, cfg.runids)
+	}
+	return nil
+}
+
+func (cfg *config) runAudit(args []string) error {
+	fs := cfg.newFlagSet("audit", "", "Search for audit events.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	atype := fs.String("atype", "", "match audit events of type (e.g., execve, write, chmod, chown, attribute)")
+	ses := fs.String("ses", "", "match audit events for session id")
+	avc := fs.Bool("avc", false, "match SELinux AVC denials, the same as -atype avc")
+	eo.groupses = fs.Bool("groupses", false, "group audit events by host and session")
+	atemplate := fs.String("atemplate", defaultAuditTemplate, "template for audit events with no dedicated formatter")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *avc {
+		if *atype != "" && strings.ToLower(*atype) != "avc" {
+			return errors.New("-avc cannot be combined with -atype")
+		}
+		*atype = "avc"
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEAUDIT
+	cfg.ses = *ses
+	cfg.atype = strings.ToLower(*atype)
+	cfg.auditTemplate, err = template.New("audit").Parse(*atemplate)
+	if err != nil {
+		return fmt.Errorf("-atemplate: %v", err)
+	}
+	return cfg.runSearch(so, eo, "audit", cfg.buildAuditSearch, "auditd")
+}
+
+func (cfg *config) runSyslog(args []string) error {
+	fs := cfg.newFlagSet("syslog", "", "Search for syslog events.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	program := fs.String("p", "", "match syslog events for program")
+	facility := fs.String("facility", "", "match syslog events for facility")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODESYSLOG
+	cfg.program = *program
+	cfg.facility = *facility
+	return cfg.runSearch(so, eo, "syslog", cfg.buildSyslogSearch, "event")
+}
+
+func (cfg *config) runQueryCommand(args []string) error {
+	fs := cfg.newFlagSet("query", "", "Search for events of any type, matching only the criteria given by the flags. Events\n"+
+		"without a summary are shown as their document, with -raw to include fields the event\n"+
+		"does not model.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	doctype := fs.String("type", "", "only match documents of type (e.g., auditd, event)")
+	category := fs.String("category", "", "only match events of category (e.g., syslog, execve)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEQUERY
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildQuerySearch(*doctype, *category)
+	}
+	return cfg.runSearch(so, eo, "query", build, *doctype)
+}
+
+func (cfg *config) runCount(args []string) error {
+	fs := cfg.newFlagSet("count", "", "Count the events matching the search in each index and in total.")
+	so := cfg.addSearchFlags(fs)
+	doctype := fs.String("type", "", "only count documents of type (e.g., auditd, event)")
+	category := fs.String("category", "", "only count events of category (e.g., syslog, execve)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = so.connect(cfg)
+	if err != nil {
+		return err
+	}
+	qry, err := cfg.buildQuerySearch(*doctype, *category)
+	if err != nil {
+		return err
+	}
+	reqs := noopRequests{endpoint: "_count", indices: cfg.indicesForRange(cfg.startDate, cfg.endDate)}
+	if done, err := so.printQuery(cfg, qry, *doctype, reqs); done {
+		return err
+	}
+	err = cfg.runCountQuery(qry, *doctype)
+	if err != nil {
+		return err
+	}
+	err = so.finish(cfg, "count")
+	if err != nil {
+		return err
+	}
+	return cfg.matched()
+}
+
+func (cfg *config) runTopCommand(args []string) error {
+	fs := cfg.newFlagSet("top", "field", "Show the most common values of field in the events matching the search, with counts.")
+	so := cfg.addSearchFlags(fs)
+	doctype := fs.String("type", "", "only match documents of type (e.g., auditd, event)")
+	category := fs.String("category", "", "only match events of category (e.g., syslog, execve)")
+	topn := fs.Int("N", 10, "number of values shown")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("top requires a single field")
+	}
+	if *topn < 1 {
+		return errors.New("-N must be at least 1")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = so.connect(cfg)
+	if err != nil {
+		return err
+	}
+	qry, err := cfg.buildQuerySearch(*doctype, *category)
+	if err != nil {
+		return err
+	}
+	qry = topQuery(qry, fs.Arg(0), *topn)
+	reqs := noopRequests{endpoint: "_search", indices: cfg.indicesForRange(cfg.startDate, cfg.endDate), combined: true}
+	if done, err := so.printQuery(cfg, qry, *doctype, reqs); done {
+		return err
+	}
+	err = cfg.runTop(qry, *doctype)
+	if err != nil {
+		return err
+	}
+	err = so.finish(cfg, "top")
+	if err != nil {
+		return err
+	}
+	return cfg.matched()
+}
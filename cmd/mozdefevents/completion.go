@@ -0,0 +1,310 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Fixed values completed for flags
+var completionValues = map[string]string{
+	"paging":  "from scroll search_after",
+	"backend": backendElasticsearch + " " + backendOpenSearch,
+	"scheme":  "http https",
+	"tsfield": "utctimestamp receivedtimestamp",
+	"list":    "filters profiles",
+}
+
+// Flags completed with the names printed by completion -list, so the
+// names are read when completing rather than when the script is generated
+var completionLists = map[string]string{
+	"filter":  "filters",
+	"profile": "profiles",
+}
+
+// Flags completed with file names
+var completionFiles = map[string]bool{
+	"config":     true,
+	"filterfile": true,
+	"Hfile":      true,
+	"query-file": true,
+	"meta":       true,
+	"cacert":     true,
+	"cert":       true,
+	"key":        true,
+	"schedule":   true,
+	"metrics":    true,
+	"resume":     true,
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// Arguments completed for subcommands in addition to their flags
+var completionArgs = map[string][]string{
+	"completion": completionShells,
+	"saved":      {"save", "list", "run", "delete"},
+}
+
+// completionFlag is a flag of a subcommand as shown in completions
+type completionFlag struct {
+	name  string
+	desc  string
+	value bool
+}
+
+// Return the flags of each subcommand, collected by running the subcommands
+// with a config that stops them once their flags are defined
+func (cfg *config) completionFlags() map[string][]completionFlag {
+	c := &config{file: cfg.file, flagSets: make(map[string]*flag.FlagSet)}
+	for _, x := range subcommands {
+		x.run(c, nil)
+	}
+	ret := make(map[string][]completionFlag)
+	for name, fs := range c.flagSets {
+		fs.VisitAll(func(f *flag.Flag) {
+			desc, _, _ := strings.Cut(f.Usage, "\n")
+			value := true
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				value = false
+			}
+			ret[name] = append(ret[name], completionFlag{name: f.Name, desc: desc, value: value})
+		})
+	}
+	return ret
+}
+
+// Return the names of the flags taking a value across all subcommands that
+// have no completion of their own
+func plainValueFlags(flags map[string][]completionFlag) []string {
+	seen := make(map[string]bool)
+	for _, x := range flags {
+		for _, f := range x {
+			if !f.value || completionValues[f.name] != "" || completionLists[f.name] != "" ||
+				completionFiles[f.name] {
+				continue
+			}
+			seen["-"+f.name] = true
+		}
+	}
+	ret := make([]string, 0, len(seen))
+	for k := range seen {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Return the keys of m prefixed with -, sorted
+func flagNames[T any](m map[string]T) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, "-"+k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Quote s for use in a single quoted shell string
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeBashCompletion(w io.Writer, flags map[string][]completionFlag) {
+	names := make([]string, 0, len(subcommands))
+	for _, x := range subcommands {
+		names = append(names, x.name)
+	}
+	fmt.Fprintf(w, "# bash completion for mozdefevents, load with: source <(mozdefevents completion bash)\n")
+	fmt.Fprintf(w, "_mozdefevents() {\n")
+	fmt.Fprintf(w, "    local cur prev flags\n")
+	fmt.Fprintf(w, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(w, "    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(w, "    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %v -- \"$cur\"))\n", shellQuote(strings.Join(names, " ")))
+	fmt.Fprintf(w, "        return\n    fi\n")
+	fmt.Fprintf(w, "    case \"$prev\" in\n")
+	for _, k := range flagNames(completionLists) {
+		fmt.Fprintf(w, "    %v)\n", k)
+		fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"$(mozdefevents completion -list %v 2>/dev/null)\" -- \"$cur\"))\n",
+			completionLists[k[1:]])
+		fmt.Fprintf(w, "        return\n        ;;\n")
+	}
+	for _, k := range flagNames(completionValues) {
+		fmt.Fprintf(w, "    %v)\n", k)
+		fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %v -- \"$cur\"))\n", shellQuote(completionValues[k[1:]]))
+		fmt.Fprintf(w, "        return\n        ;;\n")
+	}
+	fmt.Fprintf(w, "    %v)\n", strings.Join(flagNames(completionFiles), "|"))
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "        return\n        ;;\n")
+	fmt.Fprintf(w, "    %v)\n", strings.Join(plainValueFlags(flags), "|"))
+	fmt.Fprintf(w, "        return\n        ;;\n")
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    case \"${COMP_WORDS[1]}\" in\n")
+	for _, x := range subcommands {
+		words := make([]string, 0)
+		for _, f := range flags[x.name] {
+			words = append(words, "-"+f.name)
+		}
+		words = append(words, completionArgs[x.name]...)
+		fmt.Fprintf(w, "    %v)\n        flags=%v\n        ;;\n", x.name, shellQuote(strings.Join(words, " ")))
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F _mozdefevents mozdefevents\n")
+}
+
+func writeZshCompletion(w io.Writer, flags map[string][]completionFlag) {
+	fmt.Fprintf(w, "#compdef mozdefevents\n")
+	fmt.Fprintf(w, "# zsh completion for mozdefevents, load with: source <(mozdefevents completion zsh)\n\n")
+	fmt.Fprintf(w, "_mozdefevents() {\n")
+	fmt.Fprintf(w, "    local -a commands flags\n")
+	fmt.Fprintf(w, "    if (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "        commands=(\n")
+	for _, x := range subcommands {
+		fmt.Fprintf(w, "            %v\n", shellQuote(x.name+":"+x.desc))
+	}
+	fmt.Fprintf(w, "        )\n")
+	fmt.Fprintf(w, "        _describe 'command' commands\n")
+	fmt.Fprintf(w, "        return\n    fi\n")
+	fmt.Fprintf(w, "    case \"$words[CURRENT-1]\" in\n")
+	for _, k := range flagNames(completionLists) {
+		fmt.Fprintf(w, "    %v)\n", k)
+		fmt.Fprintf(w, "        compadd -- ${(f)\"$(mozdefevents completion -list %v 2>/dev/null)\"}\n",
+			completionLists[k[1:]])
+		fmt.Fprintf(w, "        return\n        ;;\n")
+	}
+	for _, k := range flagNames(completionValues) {
+		fmt.Fprintf(w, "    %v)\n", k)
+		fmt.Fprintf(w, "        compadd -- %v\n", completionValues[k[1:]])
+		fmt.Fprintf(w, "        return\n        ;;\n")
+	}
+	fmt.Fprintf(w, "    %v)\n", strings.Join(flagNames(completionFiles), "|"))
+	fmt.Fprintf(w, "        _files\n")
+	fmt.Fprintf(w, "        return\n        ;;\n")
+	fmt.Fprintf(w, "    %v)\n", strings.Join(plainValueFlags(flags), "|"))
+	fmt.Fprintf(w, "        return\n        ;;\n")
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    case \"$words[2]\" in\n")
+	for _, x := range subcommands {
+		fmt.Fprintf(w, "    %v)\n", x.name)
+		if len(completionArgs[x.name]) > 0 {
+			fmt.Fprintf(w, "        compadd -- %v\n", strings.Join(completionArgs[x.name], " "))
+		}
+		fmt.Fprintf(w, "        flags=(\n")
+		for _, f := range flags[x.name] {
+			fmt.Fprintf(w, "            %v\n", shellQuote("-"+f.name+":"+f.desc))
+		}
+		fmt.Fprintf(w, "        )\n        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    _describe 'flag' flags\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "if [ \"$funcstack[1]\" = \"_mozdefevents\" ]; then\n")
+	fmt.Fprintf(w, "    _mozdefevents \"$@\"\n")
+	fmt.Fprintf(w, "else\n")
+	fmt.Fprintf(w, "    compdef _mozdefevents mozdefevents\n")
+	fmt.Fprintf(w, "fi\n")
+}
+
+func writeFishCompletion(w io.Writer, flags map[string][]completionFlag) {
+	fmt.Fprintf(w, "# fish completion for mozdefevents, load with: mozdefevents completion fish | source\n")
+	fmt.Fprintf(w, "complete -c mozdefevents -f\n")
+	for _, x := range subcommands {
+		fmt.Fprintf(w, "complete -c mozdefevents -n __fish_use_subcommand -a %v -d %v\n",
+			x.name, shellQuote(x.desc))
+	}
+	for _, x := range subcommands {
+		if len(completionArgs[x.name]) > 0 {
+			fmt.Fprintf(w, "complete -c mozdefevents -n '__fish_seen_subcommand_from %v' -a %v\n",
+				x.name, shellQuote(strings.Join(completionArgs[x.name], " ")))
+		}
+	}
+	for _, x := range subcommands {
+		for _, f := range flags[x.name] {
+			arg := ""
+			switch {
+			case completionLists[f.name] != "":
+				arg = fmt.Sprintf(" -x -a '(mozdefevents completion -list %v 2>/dev/null)'", completionLists[f.name])
+			case completionValues[f.name] != "":
+				arg = " -x -a " + shellQuote(completionValues[f.name])
+			case completionFiles[f.name]:
+				arg = " -r -F"
+			case f.value:
+				arg = " -x"
+			}
+			fmt.Fprintf(w, "complete -c mozdefevents -n '__fish_seen_subcommand_from %v' -o %v%v -d %v\n",
+				x.name, f.name, arg, shellQuote(f.desc))
+		}
+	}
+}
+
+// Print the names used to complete flag values, the saved filters in the
+// default filter file or the profiles in the configuration file
+func (cfg *config) printCompletionList(list string) error {
+	names := make([]string, 0)
+	switch list {
+	case "filters":
+		filters, err := loadFilters(defaultFilterPath())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for k := range filters {
+			names = append(names, k)
+		}
+	case "profiles":
+		for k := range cfg.file.Profiles {
+			names = append(names, k)
+		}
+	default:
+		return fmt.Errorf("invalid list %q, must be filters or profiles", list)
+	}
+	sort.Strings(names)
+	for _, x := range names {
+		fmt.Fprintf(os.Stdout, "%v\n", x)
+	}
+	return nil
+}
+
+func (cfg *config) runCompletion(args []string) error {
+	fs := cfg.newFlagSet("completion", "bash|zsh|fish", "Print a shell completion script covering the subcommands and their flags, saved\n"+
+		"filter names and configured profile names. For example, add to ~/.bashrc:\n\n"+
+		"    source <(mozdefevents completion bash)")
+	list := fs.String("list", "", "print the saved filter names or profile names (filters or profiles), used by the scripts")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *list != "" {
+		return cfg.printCompletionList(*list)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("completion requires a shell")
+	}
+	flags := cfg.completionFlags()
+	switch fs.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout, flags)
+	case "zsh":
+		writeZshCompletion(os.Stdout, flags)
+	case "fish":
+		writeFishCompletion(os.Stdout, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q, must be bash, zsh or fish", fs.Arg(0))
+	}
+	return nil
+}
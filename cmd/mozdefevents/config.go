@@ -0,0 +1,230 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileConfig is the configuration file, values in the file are used as
+// defaults and are overridden by environment variables and flags
+type fileConfig struct {
+	ESHost       string `yaml:"eshost"`
+	Scheme       string `yaml:"scheme"`
+	CACert       string `yaml:"cacert"`
+	Cert         string `yaml:"cert"`
+	Key          string `yaml:"key"`
+	Insecure     bool   `yaml:"insecure"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password"`
+	APIKey       string `yaml:"apikey"`
+	AWSSigV4     bool   `yaml:"aws_sigv4"`
+	AWSRegion    string `yaml:"aws_region"`
+	Proxy        string `yaml:"proxy"`
+	Backend      string `yaml:"backend"`
+	Gzip         bool   `yaml:"gzip"`
+	Last         string `yaml:"last"`
+	Output       string `yaml:"output"`
+	IndexPattern string `yaml:"index_pattern"`
+	Alias        string `yaml:"alias"`
+
+	// Index settings for the alerts subcommand
+	AlertIndexPattern string `yaml:"alert_index_pattern"`
+	AlertAlias        string `yaml:"alert_alias"`
+
+	// Remote clusters searched by default, and the index settings for
+	// remote clusters that differ from the local cluster
+	Remotes        []string                `yaml:"remotes"`
+	RemoteClusters map[string]remoteConfig `yaml:"remote_clusters"`
+
+	// Enrichers run by default and the settings of the enrichers
+	Enrich     []string          `yaml:"enrich"`
+	GeoIPFile  string            `yaml:"geoip_file"`
+	Assets     []assetConfig     `yaml:"assets"`
+	ScoreRules []scoreRuleConfig `yaml:"score_rules"`
+
+	// Named profiles, values set in the selected profile override the
+	// top level values
+	Profile  string                `yaml:"profile"`
+	Profiles map[string]fileConfig `yaml:"profiles"`
+}
+
+type remoteConfig struct {
+	IndexPattern string `yaml:"index_pattern"`
+	Alias        string `yaml:"alias"`
+}
+
+// An asset group for the asset enricher, hosts are hostname regexps
+type assetConfig struct {
+	Group string   `yaml:"group"`
+	Hosts []string `yaml:"hosts"`
+}
+
+// A rule for the scoring enricher, match is a regexp matched against the
+// value of field
+type scoreRuleConfig struct {
+	Field string `yaml:"field"`
+	Match string `yaml:"match"`
+	Score int    `yaml:"score"`
+}
+
+// Overlay the values set in profile p
+func (f fileConfig) withProfile(p fileConfig) fileConfig {
+	if p.ESHost != "" {
+		f.ESHost = p.ESHost
+	}
+	if p.Scheme != "" {
+		f.Scheme = p.Scheme
+	}
+	if p.CACert != "" {
+		f.CACert = p.CACert
+	}
+	if p.Cert != "" {
+		f.Cert = p.Cert
+	}
+	if p.Key != "" {
+		f.Key = p.Key
+	}
+	if p.Insecure {
+		f.Insecure = true
+	}
+	if p.User != "" {
+		f.User = p.User
+	}
+	if p.Password != "" {
+		f.Password = p.Password
+	}
+	if p.APIKey != "" {
+		f.APIKey = p.APIKey
+	}
+	if p.AWSSigV4 {
+		f.AWSSigV4 = true
+	}
+	if p.AWSRegion != "" {
+		f.AWSRegion = p.AWSRegion
+	}
+	if p.Proxy != "" {
+		f.Proxy = p.Proxy
+	}
+	if p.Backend != "" {
+		f.Backend = p.Backend
+	}
+	if p.Gzip {
+		f.Gzip = true
+	}
+	if p.Last != "" {
+		f.Last = p.Last
+	}
+	if p.Output != "" {
+		f.Output = p.Output
+	}
+	if p.IndexPattern != "" {
+		f.IndexPattern = p.IndexPattern
+	}
+	if p.Alias != "" {
+		f.Alias = p.Alias
+	}
+	if p.AlertIndexPattern != "" {
+		f.AlertIndexPattern = p.AlertIndexPattern
+	}
+	if p.AlertAlias != "" {
+		f.AlertAlias = p.AlertAlias
+	}
+	if len(p.Remotes) > 0 {
+		f.Remotes = p.Remotes
+	}
+	if len(p.RemoteClusters) > 0 {
+		f.RemoteClusters = p.RemoteClusters
+	}
+	if len(p.Enrich) > 0 {
+		f.Enrich = p.Enrich
+	}
+	if p.GeoIPFile != "" {
+		f.GeoIPFile = p.GeoIPFile
+	}
+	if len(p.Assets) > 0 {
+		f.Assets = p.Assets
+	}
+	if len(p.ScoreRules) > 0 {
+		f.ScoreRules = p.ScoreRules
+	}
+	return f
+}
+
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mozdefevents.yaml")
+}
+
+// Find the value of a flag in the arguments, used for flags that need to be
+// known before the remaining flags are defined
+func findFlag(args []string, flagname string) (string, bool) {
+	for i, x := range args {
+		if x == "--" {
+			break
+		}
+		name := strings.TrimLeft(x, "-")
+		if name == x {
+			continue
+		}
+		if v, ok := strings.CutPrefix(name, flagname+"="); ok {
+			return v, true
+		}
+		if name == flagname && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// Load the configuration file, a missing file is only an error if it was
+// requested explicitly. The configuration file needs to be loaded before
+// the remaining flags are defined since it supplies their defaults.
+func loadFileConfig(args []string) (fileConfig, error) {
+	var ret fileConfig
+	path, explicit := findFlag(args, "config")
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	profile, _ := findFlag(args, "profile")
+	if path == "" {
+		if profile != "" {
+			return ret, fmt.Errorf("profile %q requested but no configuration file", profile)
+		}
+		return ret, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit && profile == "" {
+			return ret, nil
+		}
+		return ret, err
+	}
+	err = yaml.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("%v: %v", path, err)
+	}
+	if profile == "" {
+		profile = ret.Profile
+	}
+	if profile != "" {
+		p, ok := ret.Profiles[profile]
+		if !ok {
+			return ret, fmt.Errorf("%v: profile %q not found", path, profile)
+		}
+		ret = ret.withProfile(p)
+	}
+	return ret, nil
+}
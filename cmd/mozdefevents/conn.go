@@ -0,0 +1,217 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Supported values for -backend
+const (
+	backendElasticsearch = "elasticsearch"
+	backendOpenSearch    = "opensearch"
+)
+
+// connOptions holds the settings for the ES connection, most can be set in
+// the configuration file or using an environment variable, and overridden
+// with a flag
+type connOptions struct {
+	host     string
+	scheme   string
+	cacert   string
+	cert     string
+	key      string
+	insecure bool
+	user     string
+	password string
+	apikey   string
+	sigv4    bool
+	region   string
+	proxy    string
+	timeout  time.Duration
+	deadline time.Duration
+	backend  string
+	gzip     bool
+	verbose  bool
+	debug    bool
+}
+
+// Add the connection flags to fs, defaulting to the environment and then
+// the configuration file
+func (o *connOptions) addFlags(fs *flag.FlagSet, fc fileConfig) {
+	fs.StringVar(&o.host, "eshost", envDefault("MOZDEFESHOST", fc.ESHost),
+		"ES host to connect to, or comma separated list of nodes to fail over between (MOZDEFESHOST)")
+	fs.StringVar(&o.scheme, "scheme", envDefault("MOZDEFESSCHEME", fc.Scheme, "http"),
+		"scheme for ES connection, http or https (MOZDEFESSCHEME)")
+	fs.StringVar(&o.cacert, "cacert", envDefault("MOZDEFESCACERT", fc.CACert),
+		"CA bundle used to verify the ES server certificate (MOZDEFESCACERT)")
+	fs.StringVar(&o.cert, "cert", envDefault("MOZDEFESCERT", fc.Cert),
+		"client certificate for ES connection (MOZDEFESCERT)")
+	fs.StringVar(&o.key, "key", envDefault("MOZDEFESKEY", fc.Key),
+		"client certificate key for ES connection (MOZDEFESKEY)")
+	fs.BoolVar(&o.insecure, "insecure", os.Getenv("MOZDEFESINSECURE") != "" || fc.Insecure,
+		"skip verification of the ES server certificate (MOZDEFESINSECURE)")
+	fs.StringVar(&o.user, "user", envDefault("MOZDEFESUSER", fc.User),
+		"user for ES basic authentication, password is read from MOZDEFESPASS (MOZDEFESUSER)")
+	o.password = envDefault("MOZDEFESPASS", fc.Password)
+	fs.StringVar(&o.apikey, "apikey", envDefault("MOZDEFESAPIKEY", fc.APIKey),
+		"encoded ES API key used instead of basic authentication (MOZDEFESAPIKEY)")
+	fs.BoolVar(&o.sigv4, "aws-sigv4", os.Getenv("MOZDEFESAWSSIGV4") != "" || fc.AWSSigV4,
+		"sign requests with AWS SigV4 for Amazon OpenSearch Service (MOZDEFESAWSSIGV4)")
+	fs.StringVar(&o.region, "aws-region", envDefault("AWS_REGION", fc.AWSRegion),
+		"AWS region of the OpenSearch Service domain (AWS_REGION)")
+	fs.StringVar(&o.proxy, "proxy", envDefault("MOZDEFESPROXY", fc.Proxy),
+		"proxy URL for ES connection, http, https or socks5 (MOZDEFESPROXY, "+
+			"otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored)")
+	fs.StringVar(&o.backend, "backend", envDefault("MOZDEFESBACKEND", fc.Backend, backendElasticsearch),
+		"type of cluster, elasticsearch or opensearch (MOZDEFESBACKEND)")
+	fs.BoolVar(&o.gzip, "gzip", os.Getenv("MOZDEFESGZIP") != "" || fc.Gzip,
+		"gzip compress request bodies, only requests are affected as responses are always requested compressed (MOZDEFESGZIP)")
+	fs.DurationVar(&o.timeout, "timeout", 0, "timeout for each request to ES (e.g., 30s, 0 for none)")
+	fs.DurationVar(&o.deadline, "deadline", 0, "overall deadline for the run (e.g., 10m, 0 for none)")
+	fs.BoolVar(&o.verbose, "v", false, "log the indices queried, pages fetched and hit counts to stderr")
+	fs.BoolVar(&o.debug, "vv", false, "log each request, query and retry to stderr in addition to -v")
+}
+
+// Return the value of environment variable name if set, otherwise the
+// first non-empty default
+func envDefault(name string, defs ...string) string {
+	if name != "" {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	for _, x := range defs {
+		if x != "" {
+			return x
+		}
+	}
+	return ""
+}
+
+// Return the logger for the verbosity flags, or nil if nothing is to be
+// logged. The log goes to stderr so it is kept apart from results.
+func newLogger(verbose bool, debug bool) *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case debug:
+		level = slog.LevelDebug
+	case !verbose:
+		return nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// Apply the connection options, building the transport used by the client
+func (cfg *config) configureConn(o connOptions) error {
+	if o.host == "" {
+		return errors.New("ES host not set, use MOZDEFESHOST, -eshost or the configuration file")
+	}
+	cfg.eshost = o.host
+	if o.scheme != "http" && o.scheme != "https" {
+		return fmt.Errorf("invalid scheme %q, must be http or https", o.scheme)
+	}
+	cfg.scheme = o.scheme
+	if (o.user != "" && o.apikey != "") || (o.sigv4 && (o.user != "" || o.apikey != "")) {
+		return errors.New("only one of basic authentication, API key or AWS SigV4 can be used")
+	}
+	cfg.esuser = o.user
+	if o.user != "" {
+		cfg.espass = o.password
+	}
+
+	// The default transport uses the proxy environment variables, an
+	// explicit proxy overrides them
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.proxy != "" {
+		u, err := url.Parse(o.proxy)
+		if err != nil {
+			return err
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("invalid proxy scheme %q", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if o.scheme == "http" {
+		if o.cacert != "" || o.cert != "" || o.key != "" || o.insecure {
+			return errors.New("TLS options require the https scheme")
+		}
+	} else {
+		tlscfg := &tls.Config{InsecureSkipVerify: o.insecure}
+		if o.cacert != "" {
+			buf, err := os.ReadFile(o.cacert)
+			if err != nil {
+				return err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(buf) {
+				return fmt.Errorf("%v: no certificates found", o.cacert)
+			}
+			tlscfg.RootCAs = pool
+		}
+		if (o.cert == "") != (o.key == "") {
+			return errors.New("client certificate and key must be specified together")
+		}
+		if o.cert != "" {
+			cert, err := tls.LoadX509KeyPair(o.cert, o.key)
+			if err != nil {
+				return err
+			}
+			tlscfg.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlscfg
+	}
+	if o.timeout < 0 || o.deadline < 0 {
+		return errors.New("timeout and deadline must not be negative")
+	}
+	switch o.backend {
+	case backendElasticsearch:
+	case backendOpenSearch:
+		cfg.esVersion.OpenSearch = true
+	default:
+		return fmt.Errorf("invalid backend %q, must be elasticsearch or opensearch", o.backend)
+	}
+	cfg.timeout = o.timeout
+	var stop context.CancelFunc
+	cfg.ctx, stop = interruptContext(context.Background())
+	if o.deadline > 0 {
+		var cancel context.CancelFunc
+		cfg.ctx, cancel = context.WithTimeoutCause(cfg.ctx, o.deadline, errDeadline)
+		cfg.cancel = func() {
+			cancel()
+			stop()
+		}
+	} else {
+		cfg.cancel = stop
+	}
+	cfg.gzip = o.gzip
+	cfg.logger = newLogger(o.verbose, o.debug)
+	cfg.apikey = o.apikey
+	cfg.transport = transport
+	if o.sigv4 {
+		signer, err := newSigV4Transport(o.region, transport)
+		if err != nil {
+			return err
+		}
+		cfg.transport = signer
+	}
+	return nil
+}
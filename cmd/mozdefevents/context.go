@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"time"
+)
+
+// Context is only fetched if the match set is at most this size, as each
+// match requires additional searches
+const contextMaxMatches = 50
+
+// Build a search for the events surrounding e on the same host. Only the
+// mode and document type criteria are applied, the user filters are not since the point is
+// to see everything that happened around the match.
+func (cfg *config) buildContextSearch(e mozdefevents.Event, doctype string) mozdefevents.Query {
+	var q mozdefevents.Query
+	q.Size = cfg.pageSize
+	q.Sort = make(map[string]string)
+	q.Sort[cfg.tsField] = "asc"
+	if !cfg.raw {
+		q.Source = cfg.sourceFields()
+	}
+
+	var qc mozdefevents.Criteria
+	qc.Range = make(map[string]map[string]string)
+	qc.Range[cfg.tsField] = make(map[string]string)
+	qc.Range[cfg.tsField]["gte"] = e.Time(cfg.tsField).Add(-cfg.context).Format(time.RFC3339)
+	qc.Range[cfg.tsField]["lte"] = e.Time(cfg.tsField).Add(cfg.context).Format(time.RFC3339)
+	q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+
+	// Syslog events share the event doctype with other categories, other
+	// modes match the doctype of the search
+	switch cfg.mode {
+	case MODESYSLOG, MODESSH, MODESUDO, MODEVPN, MODEFAIL2BAN:
+		q.AddTypeMatch("event", cfg.esVersion)
+		q.AddMatch("category", "syslog")
+	default:
+		if doctype != "" {
+			q.AddTypeMatch(doctype, cfg.esVersion)
+		}
+	}
+
+	host := e.Hostname
+	if host == "" {
+		host = e.Details.Hostname
+	}
+	q.Query.Bool.MinShouldMatch = 1
+	for _, x := range []string{"hostname", "details.dhost", "details.hostname"} {
+		qc = mozdefevents.Criteria{}
+		qc.Match = make(map[string]string)
+		qc.Match[x] = host
+		q.Query.Bool.Should = append(q.Query.Bool.Should, qc)
+	}
+	q.ApplyNested(cfg.nestedPath)
+	return q
+}
+
+// Print the events surrounding each match, with groups separated by --
+// similar to grep -C
+func (cfg *config) showContext(ctx context.Context, doctype string) error {
+	if len(cfg.contextMatches) > contextMaxMatches {
+		fmt.Fprintf(os.Stderr, "warning: %v matches exceeds context limit of %v, "+
+			"showing matches only\n", len(cfg.contextMatches), contextMaxMatches)
+		return cfg.printResults(cfg.contextMatches)
+	}
+	for i, x := range cfg.contextMatches {
+		if i > 0 {
+			fmt.Fprintf(os.Stdout, "--\n")
+		}
+		qry := cfg.buildContextSearch(x, doctype)
+		start := x.Time(cfg.tsField).Add(-cfg.context)
+		end := x.Time(cfg.tsField).Add(cfg.context)
+		err := cfg.streamEvents(ctx, qry, cfg.indicesForRange(start, end), doctype, cfg.printResults)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression, each field is the set of values
+// it matches. A schedule given as @every duration runs at a fixed interval
+// instead.
+type cronSchedule struct {
+	minute map[int]bool
+	hour   map[int]bool
+	dom    map[int]bool
+	month  map[int]bool
+	dow    map[int]bool
+	anyDom bool
+	anyDow bool
+	every  time.Duration
+}
+
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse a standard five field cron expression (minute hour day-of-month
+// month day-of-week), one of the @hourly style aliases, or @every duration
+func parseCron(spec string) (cronSchedule, error) {
+	var ret cronSchedule
+	spec = strings.TrimSpace(spec)
+	if v, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return ret, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+		if d < time.Minute {
+			return ret, fmt.Errorf("schedule %q: interval must be at least 1m", spec)
+		}
+		ret.every = d
+		return ret, nil
+	}
+	if v, ok := cronAliases[spec]; ok {
+		spec = v
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return ret, fmt.Errorf("schedule %q must have five fields", spec)
+	}
+	var err error
+	bounds := []struct {
+		set *map[int]bool
+		min int
+		max int
+	}{
+		{&ret.minute, 0, 59},
+		{&ret.hour, 0, 23},
+		{&ret.dom, 1, 31},
+		{&ret.month, 1, 12},
+		{&ret.dow, 0, 7},
+	}
+	for i, x := range bounds {
+		*x.set, err = parseCronField(fields[i], x.min, x.max)
+		if err != nil {
+			return ret, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+	}
+	// Sunday can be given as 0 or 7
+	if ret.dow[7] {
+		ret.dow[0] = true
+	}
+	ret.anyDom = fields[2] == "*"
+	ret.anyDow = fields[4] == "*"
+	return ret, nil
+}
+
+// Parse a comma separated list of values, ranges and steps such as
+// 1,5-10,*/15
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	ret := make(map[int]bool)
+	for _, x := range strings.Split(field, ",") {
+		rng, stepstr, hasStep := strings.Cut(x, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepstr)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", x)
+			}
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value in %q", x)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(b)
+				if err != nil {
+					return nil, fmt.Errorf("invalid range in %q", x)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q out of range %v-%v", x, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			ret[i] = true
+		}
+	}
+	return ret, nil
+}
+
+// Return true if the schedule matches the day of t. As with cron, if both
+// the day of month and day of week are restricted a day matching either is
+// used.
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom[t.Day()]
+	dow := c.dow[int(t.Weekday())]
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// Return the first time after t the schedule runs, in the location of t.
+// The zero time is returned for a schedule that cannot match, such as the
+// 31st of February.
+func (c cronSchedule) next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	n := t.Truncate(time.Minute).Add(time.Minute)
+	limit := n.AddDate(5, 0, 0)
+	loc := t.Location()
+	for n.Before(limit) {
+		switch {
+		case !c.month[int(n.Month())]:
+			n = time.Date(n.Year(), n.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchesDay(n):
+			n = time.Date(n.Year(), n.Month(), n.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour[n.Hour()]:
+			n = time.Date(n.Year(), n.Month(), n.Day(), n.Hour()+1, 0, 0, 0, loc)
+		case !c.minute[n.Minute()]:
+			n = n.Add(time.Minute)
+		default:
+			return n
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,285 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Time a job is given to flush its results after being interrupted when
+// the daemon stops, before it is killed
+const daemonStopDelay = 30 * time.Second
+
+// daemonConfig is the schedule file for daemon mode
+//
+//	timezone: America/Los_Angeles
+//	jobs:
+//	  - name: weekly-sudo
+//	    schedule: "0 8 * * 1"
+//	    saved: sudo-review
+//	  - name: syslog-errors
+//	    schedule: "@every 1h"
+//	    command: syslog
+//	    args: ["-severity", "error+", "-last", "1h"]
+//	    output: file:/var/log/mozdefevents/errors.log
+type daemonConfig struct {
+	Timezone string      `yaml:"timezone"`
+	Jobs     []daemonJob `yaml:"jobs"`
+}
+
+// daemonJob is a search run on a schedule, either a saved search or a
+// subcommand with its flags. The output of each run is written to the
+// output sink, a file:/path appended to, a unix:/path socket or fifo:/path
+// named pipe, or stdout if not set.
+type daemonJob struct {
+	Name     string   `yaml:"name"`
+	Schedule string   `yaml:"schedule"`
+	Saved    string   `yaml:"saved"`
+	Command  string   `yaml:"command"`
+	Args     []string `yaml:"args"`
+	Output   string   `yaml:"output"`
+
+	sched   cronSchedule
+	running bool
+}
+
+// Return the arguments to run the job with
+func (j *daemonJob) commandArgs() []string {
+	if j.Saved != "" {
+		return []string{"saved", "run", j.Saved}
+	}
+	return append([]string{j.Command}, j.Args...)
+}
+
+// Load and validate the schedule file
+func (cfg *config) loadDaemonConfig(path string) (daemonConfig, error) {
+	var ret daemonConfig
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return ret, err
+	}
+	err = yaml.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("%v: %v", path, err)
+	}
+	if len(ret.Jobs) == 0 {
+		return ret, fmt.Errorf("%v: no jobs", path)
+	}
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return ret, err
+	}
+	names := make(map[string]bool)
+	for i := range ret.Jobs {
+		j := &ret.Jobs[i]
+		if j.Name == "" {
+			return ret, fmt.Errorf("%v: job %v has no name", path, i+1)
+		}
+		if names[j.Name] {
+			return ret, fmt.Errorf("%v: duplicate job %q", path, j.Name)
+		}
+		names[j.Name] = true
+		j.sched, err = parseCron(j.Schedule)
+		if err != nil {
+			return ret, fmt.Errorf("%v: job %q: %v", path, j.Name, err)
+		}
+		switch {
+		case (j.Saved == "") == (j.Command == ""):
+			return ret, fmt.Errorf("%v: job %q must have one of saved or command", path, j.Name)
+		case j.Saved != "":
+			if _, ok := saved[j.Saved]; !ok {
+				return ret, fmt.Errorf("%v: job %q: no saved search %q", path, j.Name, j.Saved)
+			}
+		default:
+			err = cfg.validateSaved(j.Command, j.Args)
+			if err != nil {
+				return ret, fmt.Errorf("%v: job %q: %v", path, j.Name, err)
+			}
+		}
+		if j.Output != "" && j.Output != "stdout" && !strings.HasPrefix(j.Output, "file:") {
+			// Sockets and pipes are opened when the job runs, as the
+			// reader may not be present yet
+			_, _, found := strings.Cut(j.Output, ":")
+			if !found {
+				return ret, fmt.Errorf("%v: job %q: invalid output %q", path, j.Name, j.Output)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Open the output sink of a job writing somewhere other than stdout
+func openJobOutput(dest string) (io.WriteCloser, error) {
+	if path, ok := strings.CutPrefix(dest, "file:"); ok {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	}
+	return openOutput(dest)
+}
+
+// Run a job as a child process so each run has its own settings and
+// output, logging the outcome and anything the job wrote to stderr. Output
+// for stdout is buffered and written under outmu so jobs running at the
+// same time are not interleaved.
+func runDaemonJob(ctx context.Context, logger *slog.Logger, exe string, j *daemonJob, outmu *sync.Mutex) {
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe, j.commandArgs()...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Interrupt a running job when the daemon stops so it flushes the
+	// results collected so far
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = daemonStopDelay
+	if j.Output != "" && j.Output != "stdout" {
+		out, err := openJobOutput(j.Output)
+		if err != nil {
+			logger.Error("opening job output", "job", j.Name, "output", j.Output, "error", err)
+			return
+		}
+		defer out.Close()
+		cmd.Stdout = out
+	}
+	logger.Info("job started", "job", j.Name, "args", strings.Join(j.commandArgs(), " "))
+	err := cmd.Run()
+	if stdout.Len() > 0 {
+		outmu.Lock()
+		os.Stdout.Write(stdout.Bytes())
+		outmu.Unlock()
+	}
+	scanner := bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		logger.Warn("job stderr", "job", j.Name, "line", scanner.Text())
+	}
+	elapsed := time.Since(start).Round(time.Millisecond)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		logger.Info("job finished", "job", j.Name, "elapsed", elapsed)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == exitNoResults:
+		logger.Info("job finished, no events matched", "job", j.Name, "elapsed", elapsed)
+	default:
+		logger.Error("job failed", "job", j.Name, "elapsed", elapsed, "error", err)
+	}
+}
+
+// Run the scheduled jobs until interrupted, a job still running when it is
+// next due is skipped for that run
+func (cfg *config) runDaemon(args []string) error {
+	fs := cfg.newFlagSet("daemon", "", "Run searches on a schedule given by a YAML schedule file, writing the output of each\n"+
+		"run to the sink configured for the job. Schedules are five field cron expressions,\n"+
+		"@hourly, @daily, @weekly, @monthly or @every duration.")
+	schedpath := fs.String("schedule", "", "path to the schedule file")
+	check := fs.Bool("check", false, "validate the schedule file, print the next run of each job and exit")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *schedpath == "" {
+		fs.Usage()
+		return errUsage
+	}
+	dcfg, err := cfg.loadDaemonConfig(*schedpath)
+	if err != nil {
+		return err
+	}
+	loc := time.Local
+	if dcfg.Timezone != "" {
+		loc, err = time.LoadLocation(dcfg.Timezone)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now().In(loc)
+	next := make([]time.Time, len(dcfg.Jobs))
+	for i := range dcfg.Jobs {
+		next[i] = dcfg.Jobs[i].sched.next(now)
+	}
+	if *check {
+		for i, x := range dcfg.Jobs {
+			when := "never"
+			if !next[i].IsZero() {
+				when = next[i].Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%-20v %v\n", x.Name, when)
+		}
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var outmu sync.Mutex
+	logger.Info("daemon started", "jobs", len(dcfg.Jobs), "schedule", *schedpath)
+	for {
+		var earliest time.Time
+		for _, x := range next {
+			if !x.IsZero() && (earliest.IsZero() || x.Before(earliest)) {
+				earliest = x
+			}
+		}
+		if earliest.IsZero() {
+			return errors.New("no jobs are scheduled to run")
+		}
+		t := time.NewTimer(time.Until(earliest))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			logger.Info("daemon stopping, waiting for running jobs")
+			wg.Wait()
+			return nil
+		case <-t.C:
+		}
+		now = time.Now().In(loc)
+		for i := range dcfg.Jobs {
+			j := &dcfg.Jobs[i]
+			if next[i].IsZero() || next[i].After(now) {
+				continue
+			}
+			next[i] = j.sched.next(now)
+			mu.Lock()
+			if j.running {
+				mu.Unlock()
+				logger.Warn("job still running, skipping", "job", j.Name)
+				continue
+			}
+			j.running = true
+			mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runDaemonJob(ctx, logger, exe, j, &outmu)
+				mu.Lock()
+				j.running = false
+				mu.Unlock()
+			}()
+		}
+	}
+}
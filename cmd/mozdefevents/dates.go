@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02 15:04:05"
+
+// Parse a duration, in addition to the units supported by time.Duration
+// d (days) and w (weeks) are accepted
+func parseDuration(s string) (time.Duration, error) {
+	mult := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		mult = time.Hour * 24
+	case strings.HasSuffix(s, "w"):
+		mult = time.Hour * 24 * 7
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(n) * mult, nil
+}
+
+// Epoch values above this are treated as milliseconds rather than seconds,
+// in seconds this would be in the year 5138
+const epochMillisThreshold = 100000000000
+
+// Parse a date argument, which is either in the fixed layout, now, epoch
+// seconds or milliseconds, or a duration relative to now such as -24h or -7d
+func (cfg *config) parseDate(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n >= epochMillisThreshold {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	if strings.HasPrefix(s, "-") {
+		d, err := parseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	loc := cfg.location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(dateLayout, s, loc)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// Load the display and input time zone, from the -tz flag if set or
+// otherwise from the TZ environment variable
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		tz = os.Getenv("TZ")
+	}
+	if tz == "" {
+		return nil, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// Convert a timestamp to the configured time zone for display
+func (cfg *config) displayTime(t time.Time) time.Time {
+	if cfg.location == nil {
+		return t
+	}
+	return t.In(cfg.location)
+}
+
+func (cfg *config) parseDates(begin string, end string) error {
+	var err error
+	now := time.Now().UTC()
+	cfg.startDate, err = cfg.parseDate(begin, now)
+	if err != nil {
+		return err
+	}
+	if end == "" {
+		cfg.endDate = now
+	} else {
+		cfg.endDate, err = cfg.parseDate(end, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the search window to the duration preceding now, as an alternative to
+// specifying begin and end dates
+func (cfg *config) parseLast(last string, begin string, end string) error {
+	if begin != "" || end != "" {
+		return errors.New("-last cannot be combined with -b or -e")
+	}
+	d, err := parseDuration(last)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return errors.New("-last must be a positive duration")
+	}
+	cfg.endDate = time.Now().UTC()
+	cfg.startDate = cfg.endDate.Add(-d)
+	return nil
+}
+
+// Searches covering more than this require -force, since each day is a
+// separate index and an accidental range can generate a large load
+const maxRangeWithoutForce = time.Hour * 24 * 90
+
+// Validate the search window, rejecting ranges that would silently return
+// nothing or are unreasonably large
+func (cfg *config) validateDates(force bool) error {
+	if !cfg.endDate.After(cfg.startDate) {
+		return fmt.Errorf("end date %v is not after start date %v",
+			cfg.endDate.Format(time.RFC3339), cfg.startDate.Format(time.RFC3339))
+	}
+	if !force && cfg.endDate.Sub(cfg.startDate) > maxRangeWithoutForce {
+		return fmt.Errorf("search range of %v days exceeds %v days, use -force to search anyway",
+			int(cfg.endDate.Sub(cfg.startDate).Hours()/24), int(maxRangeWithoutForce.Hours()/24))
+	}
+	return nil
+}
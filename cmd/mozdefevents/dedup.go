@@ -0,0 +1,77 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strings"
+)
+
+// dedupGroups collapses events sharing the same values for the key fields,
+// retaining the first event seen for each key and a count
+type dedupGroups struct {
+	fields []string
+	order  []string
+	first  map[string]mozdefevents.Event
+	counts map[string]int
+}
+
+func newDedupGroups(fields []string) *dedupGroups {
+	return &dedupGroups{
+		fields: fields,
+		first:  make(map[string]mozdefevents.Event),
+		counts: make(map[string]int),
+	}
+}
+
+func (d *dedupGroups) add(results []mozdefevents.Event) error {
+	for _, x := range results {
+		vals := make([]string, 0, len(d.fields))
+		for _, y := range d.fields {
+			v, err := x.FieldValue(y)
+			if err != nil {
+				return err
+			}
+			vals = append(vals, v)
+		}
+		key := strings.Join(vals, "\x00")
+		if _, ok := d.first[key]; !ok {
+			d.order = append(d.order, key)
+			d.first[key] = x
+		}
+		d.counts[key]++
+	}
+	return nil
+}
+
+// Show each distinct event prefixed with the number of times it was seen,
+// similar to uniq -c
+func (d *dedupGroups) show(cfg *config) error {
+	for _, x := range d.order {
+		if cfg.output != nil {
+			rec := struct {
+				mozdefevents.Event
+				Count int `json:"count"`
+			}{d.first[x], d.counts[x]}
+			err := json.NewEncoder(cfg.output).Encode(rec)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "%7v ", d.counts[x])
+		err := cfg.printResults([]mozdefevents.Event{d.first[x]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
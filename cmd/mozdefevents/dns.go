@@ -0,0 +1,141 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strings"
+)
+
+// dnsFilter selects the queries shown by the dns subcommand
+type dnsFilter struct {
+	domain string
+	qtype  string
+	rcode  string
+	client string
+}
+
+// Match events exactly on the criteria, events without a query name are
+// kept so they are shown rather than silently dropped
+func (f dnsFilter) match(e mozdefevents.Event) bool {
+	d := e.Details
+	switch {
+	case f.qtype != "" && !strings.EqualFold(d.QTypeName, f.qtype):
+		return false
+	case f.rcode != "" && !strings.EqualFold(d.RCodeName, f.rcode):
+		return false
+	case f.client != "" && d.SourceIPAddress != f.client:
+		return false
+	}
+	return true
+}
+
+// Build a search for DNS query events, either events categorized as DNS
+// events or Zeek dns log events. The domain regexp is matched by the search
+// against the whole query name, ignoring case and any trailing dot.
+func (cfg *config) buildDNSSearch(f dnsFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	should := []mozdefevents.Criteria{
+		{Match: map[string]string{"category": "dns"}},
+		{Match: map[string]string{"source": "dns"}},
+	}
+	clause, err := cfg.shouldClause(should)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if f.domain != "" {
+		var qc mozdefevents.Criteria
+		qc.QueryString = make(map[string]string)
+		qc.QueryString["query"] = fmt.Sprintf("details.query: /(%v)\\.?/",
+			mozdefevents.CaseInsensitiveRegexp(f.domain))
+		ret.Query.Bool.Must = append(ret.Query.Bool.Must, qc)
+	}
+	if f.qtype != "" {
+		ret.AddMatch("details.qtype_name", f.qtype)
+	}
+	if f.rcode != "" {
+		ret.AddMatch("details.rcode_name", f.rcode)
+	}
+	if f.client != "" {
+		ret.AddMatch("details.sourceipaddress", f.client)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show DNS queries with the client that made each, other events such as
+// those without a query name or shown with -context are shown as query
+// results
+func (cfg *config) dnsResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		if d.Query == "" {
+			cfg.queryResults([]mozdefevents.Event{x})
+			continue
+		}
+		client := d.SourceIPAddress
+		if client == "" {
+			client = "unknown"
+		}
+		evstr := fmt.Sprintf("[dns] client:%v query:%q", client, d.Query)
+		if d.QTypeName != "" {
+			evstr += " type:" + d.QTypeName
+		}
+		if d.RCodeName != "" {
+			evstr += " rcode:" + d.RCodeName
+		}
+		host := x.Hostname
+		if host == "" {
+			host = d.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+func (cfg *config) runDNS(args []string) error {
+	fs := cfg.newFlagSet("dns", "", "Search for DNS query events, showing the client, query name, type and response\n"+
+		"code of each. -domain is a regexp matched against the whole query name, as with -H.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f dnsFilter
+	fs.StringVar(&f.domain, "domain", "", "match queries for names matching regexp (e.g., '(.*\\.)?evil\\.example')")
+	fs.StringVar(&f.qtype, "qtype", "", "match queries of type (e.g., A, TXT)")
+	fs.StringVar(&f.rcode, "rcode", "", "match queries with response code (e.g., NXDOMAIN)")
+	fs.StringVar(&f.client, "client", "", "match queries from client address")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(f.domain, "/") {
+		return errors.New("-domain cannot contain /")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEDNS
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildDNSSearch(f)
+	}
+	return cfg.runSearch(so, eo, "dns", build, "")
+}
@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"regexp"
+)
+
+// Register the enrichers that are set up from the configuration file, the
+// geoip database, the asset groups and the score rules replacing the
+// default rules if any are configured
+func (cfg *config) registerEnrichers() {
+	f := cfg.file
+	mozdefevents.RegisterEnricher("geoip", func() (mozdefevents.Enricher, error) {
+		if f.GeoIPFile == "" {
+			return nil, errors.New("geoip_file is not set in the configuration file")
+		}
+		fd, err := os.Open(f.GeoIPFile)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		db, err := mozdefevents.LoadGeoIPCSV(fd)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", f.GeoIPFile, err)
+		}
+		return mozdefevents.NewGeoIPEnricher(db), nil
+	})
+	mozdefevents.RegisterEnricher("asset", func() (mozdefevents.Enricher, error) {
+		if len(f.Assets) == 0 {
+			return nil, errors.New("assets are not set in the configuration file")
+		}
+		assets := make([]mozdefevents.Asset, 0, len(f.Assets))
+		for _, x := range f.Assets {
+			a := mozdefevents.Asset{Group: x.Group}
+			for _, y := range x.Hosts {
+				re, err := regexp.Compile(y)
+				if err != nil {
+					return nil, fmt.Errorf("asset %v: %v", x.Group, err)
+				}
+				a.Hosts = append(a.Hosts, re)
+			}
+			assets = append(assets, a)
+		}
+		return mozdefevents.NewAssetEnricher(assets), nil
+	})
+	if len(f.ScoreRules) == 0 {
+		return
+	}
+	mozdefevents.RegisterEnricher("scoring", func() (mozdefevents.Enricher, error) {
+		rules := make([]mozdefevents.ScoreRule, 0, len(f.ScoreRules))
+		for _, x := range f.ScoreRules {
+			re, err := regexp.Compile(x.Match)
+			if err != nil {
+				return nil, fmt.Errorf("score rule for %v: %v", x.Field, err)
+			}
+			rules = append(rules, mozdefevents.ScoreRule{Field: x.Field, Match: re, Score: x.Score})
+		}
+		return mozdefevents.NewScoringEnricher(rules), nil
+	})
+}
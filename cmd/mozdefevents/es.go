@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"net"
+	"os"
+	"strings"
+)
+
+var errDeadline = errors.New("deadline for run exceeded")
+
+// Return the addresses of the ES hosts, cfg.eshost can be a comma separated
+// list of nodes. The scheme and default port are added if they are not
+// included in a host.
+func (cfg *config) esAddresses() []string {
+	ret := make([]string, 0)
+	for _, x := range strings.Split(cfg.eshost, ",") {
+		host := strings.TrimSpace(x)
+		if host == "" {
+			continue
+		}
+		if strings.Contains(host, "://") {
+			ret = append(ret, host)
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "9200")
+		}
+		ret = append(ret, cfg.scheme+"://"+host)
+	}
+	return ret
+}
+
+// Return the client for the configured ES host, the client is created on
+// first use
+func (cfg *config) newConn() (*mozdefevents.Client, error) {
+	if cfg.conn != nil {
+		return cfg.conn, nil
+	}
+	opts := []mozdefevents.Option{
+		mozdefevents.WithTransport(cfg.transport),
+		mozdefevents.WithVersion(cfg.esVersion),
+		mozdefevents.WithTimeout(cfg.timeout),
+		mozdefevents.WithBudget(cfg.requestBudget),
+		mozdefevents.WithPaging(cfg.paging),
+		mozdefevents.WithPageDelay(cfg.pageDelay),
+		mozdefevents.WithWarnf(func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+		}),
+		mozdefevents.WithOnPage(cfg.timing.addPage),
+	}
+	if cfg.logger != nil {
+		opts = append(opts, mozdefevents.WithLogger(cfg.logger))
+	}
+	if cfg.esuser != "" {
+		opts = append(opts, mozdefevents.WithBasicAuth(cfg.esuser, cfg.espass))
+	}
+	if cfg.apikey != "" {
+		opts = append(opts, mozdefevents.WithAPIKey(cfg.apikey))
+	}
+	if cfg.gzip {
+		opts = append(opts, mozdefevents.WithGzip())
+	}
+	if cfg.usePIT {
+		opts = append(opts, mozdefevents.WithPIT())
+	}
+	if len(cfg.enrichers) > 0 {
+		opts = append(opts, mozdefevents.WithEnrichers(cfg.enrichers...))
+	}
+	// In follow mode the newest index is expected to be changing
+	if cfg.follow != nil {
+		opts = append(opts, mozdefevents.WithoutReconcile())
+	}
+	client, err := mozdefevents.NewClient(cfg.esAddresses(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	cfg.conn = client
+	return cfg.conn, nil
+}
+
+// Query the cluster version, which selects between the typed and typeless
+// query paths
+func (cfg *config) detectVersion() error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	err = conn.DetectVersion(cfg.ctx)
+	if err != nil {
+		return err
+	}
+	cfg.esVersion = conn.Version
+	return nil
+}
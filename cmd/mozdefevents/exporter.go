@@ -0,0 +1,404 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Number of values of each field a grouped metric is reported for, unless
+// set by the metric
+const defaultMetricSize = 100
+
+var (
+	metricNameRe   = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelInvalidRe = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// exporterConfig is the metrics file for exporter mode
+//
+//	interval: 5m
+//	metrics:
+//	  - name: mozdef_execve_events
+//	    help: execve events in the last hour
+//	    search: {type: audit, last: 1h, atype: execve}
+//	    by: [hostname, category]
+//	  - name: mozdef_syslog_errors
+//	    search: {type: syslog, last: 15m, severity: error+}
+type exporterConfig struct {
+	Interval string           `yaml:"interval"`
+	Metrics  []exporterMetric `yaml:"metrics"`
+
+	interval time.Duration
+}
+
+// exporterMetric is a gauge set from the number of events matching a
+// search, either in total or for each combination of the values of the by
+// fields, which become the labels of the gauge
+type exporterMetric struct {
+	Name   string        `yaml:"name"`
+	Help   string        `yaml:"help"`
+	Search searchRequest `yaml:"search"`
+	By     []string      `yaml:"by"`
+	Size   int           `yaml:"size"`
+
+	labels []string
+}
+
+// metricSample is a single value of a gauge and its label values
+type metricSample struct {
+	labels []string
+	value  int
+}
+
+// metricState is the result of the last run of a metric. The samples are
+// those of the last successful run, so a failing search leaves the previous
+// values in place with success reported as 0.
+type metricState struct {
+	samples  []metricSample
+	success  bool
+	lastRun  time.Time
+	duration time.Duration
+}
+
+// metricsExporter runs the metric searches on an interval and serves the
+// results on /metrics
+type metricsExporter struct {
+	base       *config
+	filterfile string
+	deadline   time.Duration
+	metrics    []exporterMetric
+	logger     *slog.Logger
+
+	mu    sync.Mutex
+	state map[string]metricState
+}
+
+// Load and validate the metrics file
+func loadExporterConfig(path string) (exporterConfig, error) {
+	var ret exporterConfig
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return ret, err
+	}
+	err = yaml.Unmarshal(buf, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("%v: %v", path, err)
+	}
+	if len(ret.Metrics) == 0 {
+		return ret, fmt.Errorf("%v: no metrics", path)
+	}
+	ret.interval = 5 * time.Minute
+	if ret.Interval != "" {
+		ret.interval, err = parseDuration(ret.Interval)
+		if err != nil {
+			return ret, fmt.Errorf("%v: interval: %v", path, err)
+		}
+		if ret.interval < time.Minute {
+			return ret, fmt.Errorf("%v: interval must be at least 1m", path)
+		}
+	}
+	names := make(map[string]bool)
+	for i := range ret.Metrics {
+		m := &ret.Metrics[i]
+		if !metricNameRe.MatchString(m.Name) {
+			return ret, fmt.Errorf("%v: metric %v has invalid name %q", path, i+1, m.Name)
+		}
+		if names[m.Name] {
+			return ret, fmt.Errorf("%v: duplicate metric %q", path, m.Name)
+		}
+		names[m.Name] = true
+		if m.Search.Sort != "" || m.Search.Limit != 0 {
+			return ret, fmt.Errorf("%v: metric %q: sort and limit do not apply to metrics", path, m.Name)
+		}
+		if m.Size < 0 {
+			return ret, fmt.Errorf("%v: metric %q: size must not be negative", path, m.Name)
+		}
+		if m.Size == 0 {
+			m.Size = defaultMetricSize
+		}
+		seen := make(map[string]bool)
+		for _, x := range m.By {
+			l := labelInvalidRe.ReplaceAllString(x, "_")
+			if x == "" || seen[l] {
+				return ret, fmt.Errorf("%v: metric %q: invalid or duplicate by field %q", path, m.Name, x)
+			}
+			seen[l] = true
+			m.labels = append(m.labels, l)
+		}
+	}
+	return ret, nil
+}
+
+// Convert a search into nested terms aggregations over the by fields, so
+// the buckets count the events for each combination of values
+func metricQuery(qry mozdefevents.Query, by []string, size int) mozdefevents.Query {
+	qry.Size = 0
+	qry.Sort = nil
+	qry.Source = nil
+	var aggs map[string]mozdefevents.Aggregation
+	for i := len(by) - 1; i >= 0; i-- {
+		aggs = map[string]mozdefevents.Aggregation{
+			"by": {Terms: &mozdefevents.TermsAgg{Field: by[i], Size: size}, Aggs: aggs},
+		}
+	}
+	qry.Aggs = aggs
+	return qry
+}
+
+// Append a sample for each leaf bucket of the nested terms aggregations,
+// labelled with the keys of the buckets leading to it
+func metricSamples(ret []metricSample, res mozdefevents.AggResult, labels []string) []metricSample {
+	for _, x := range res.Buckets {
+		l := append(append([]string{}, labels...), x.Key.String())
+		sub, ok := x.Aggs["by"]
+		if !ok {
+			ret = append(ret, metricSample{labels: l, value: x.DocCount})
+			continue
+		}
+		ret = metricSamples(ret, sub, l)
+	}
+	return ret
+}
+
+// Count the events matching the search in each index and return the total
+func (cfg *config) countEvents(qry mozdefevents.Query, doctype string) (int, error) {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, x := range cfg.indicesForRange(cfg.startDate, cfg.endDate) {
+		n, err := conn.Count(cfg.ctx, x, doctype, qry)
+		if mozdefevents.IsIndexNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Run the search of a metric and return its samples
+func (e *metricsExporter) collect(ctx context.Context, m exporterMetric) ([]metricSample, error) {
+	cfg, build, doctype, err := e.base.requestConfig(m.Search, e.filterfile)
+	if err != nil {
+		return nil, err
+	}
+	if e.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, e.deadline, errDeadline)
+		defer cancel()
+	}
+	cfg.ctx = ctx
+	qry, err := build()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.By) == 0 {
+		n, err := cfg.countEvents(qry, doctype)
+		if err != nil {
+			return nil, err
+		}
+		return []metricSample{{value: n}}, nil
+	}
+	conn, err := cfg.newConn()
+	if err != nil {
+		return nil, err
+	}
+	res, err := cfg.searchRange(conn, metricQuery(qry, m.By, m.Size), doctype)
+	if err != nil {
+		return nil, err
+	}
+	var aggs map[string]mozdefevents.AggResult
+	err = json.Unmarshal(res.Aggregations, &aggs)
+	if err != nil {
+		return nil, err
+	}
+	return metricSamples(nil, aggs["by"], nil), nil
+}
+
+// Run the searches of all the metrics, updating the state of each
+func (e *metricsExporter) refresh(ctx context.Context) {
+	for _, m := range e.metrics {
+		start := time.Now()
+		samples, err := e.collect(ctx, m)
+		if ctx.Err() != nil {
+			return
+		}
+		elapsed := time.Since(start)
+		e.mu.Lock()
+		st := e.state[m.Name]
+		st.success = err == nil
+		st.lastRun = start
+		st.duration = elapsed
+		if err == nil {
+			st.samples = samples
+		}
+		e.state[m.Name] = st
+		e.mu.Unlock()
+		if err != nil {
+			e.logger.Error("metric search failed", "metric", m.Name, "error", err)
+			continue
+		}
+		e.logger.Info("metric updated", "metric", m.Name, "samples", len(samples),
+			"elapsed", elapsed.Round(time.Millisecond))
+	}
+}
+
+// Quote a label value for the exposition format
+func labelValue(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// Write a sample line with the label names and values
+func writeSample(w io.Writer, name string, names []string, values []string, value interface{}) {
+	fmt.Fprint(w, name)
+	if len(names) > 0 {
+		pairs := make([]string, len(names))
+		for i := range names {
+			pairs[i] = names[i] + "=" + labelValue(values[i])
+		}
+		fmt.Fprintf(w, "{%v}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(w, " %v\n", value)
+}
+
+// Write the metrics in the Prometheus text exposition format, with a
+// success, last run and duration gauge for each metric's search
+func (e *metricsExporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range e.metrics {
+		st, ok := e.state[m.Name]
+		if !ok {
+			continue
+		}
+		if m.Help != "" {
+			fmt.Fprintf(w, "# HELP %v %v\n", m.Name, strings.ReplaceAll(m.Help, "\n", " "))
+		}
+		fmt.Fprintf(w, "# TYPE %v gauge\n", m.Name)
+		samples := append([]metricSample{}, st.samples...)
+		sort.Slice(samples, func(i, j int) bool {
+			return strings.Join(samples[i].labels, "\x00") < strings.Join(samples[j].labels, "\x00")
+		})
+		for _, x := range samples {
+			writeSample(w, m.Name, m.labels, x.labels, x.value)
+		}
+	}
+	status := []struct {
+		name string
+		help string
+		f    func(metricState) interface{}
+	}{
+		{"mozdefevents_exporter_search_success", "whether the last search of the metric succeeded",
+			func(st metricState) interface{} {
+				if st.success {
+					return 1
+				}
+				return 0
+			}},
+		{"mozdefevents_exporter_search_timestamp_seconds", "time of the last search of the metric",
+			func(st metricState) interface{} { return st.lastRun.Unix() }},
+		{"mozdefevents_exporter_search_duration_seconds", "duration of the last search of the metric",
+			func(st metricState) interface{} { return st.duration.Seconds() }},
+	}
+	for _, x := range status {
+		fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v gauge\n", x.name, x.help, x.name)
+		for _, m := range e.metrics {
+			st, ok := e.state[m.Name]
+			if !ok {
+				continue
+			}
+			writeSample(w, x.name, []string{"metric"}, []string{m.Name}, x.f(st))
+		}
+	}
+}
+
+// Run the metric searches on an interval, serving the results on /metrics
+// until interrupted
+func (cfg *config) runExporter(args []string) error {
+	fs := cfg.newFlagSet("exporter", "", "Run searches on an interval given by a YAML metrics file and expose the number of\n"+
+		"events matching each as a Prometheus gauge on /metrics. A metric with by fields is\n"+
+		"reported for each combination of the values of the fields, which become its labels.\n"+
+		"The search of a metric takes the fields of a serve search request.")
+	vo := cfg.addServerFlags(fs, "localhost:9180")
+	metricspath := fs.String("metrics", "", "path to the metrics file")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *metricspath == "" {
+		fs.Usage()
+		return errUsage
+	}
+	ecfg, err := loadExporterConfig(*metricspath)
+	if err != nil {
+		return err
+	}
+	err = vo.apply(cfg)
+	if err != nil {
+		return err
+	}
+	// Check the searches are valid before serving
+	for _, m := range ecfg.Metrics {
+		_, build, _, err := cfg.requestConfig(m.Search, *vo.filterfile)
+		if err == nil {
+			_, err = build()
+		}
+		if err != nil {
+			return fmt.Errorf("%v: metric %q: %v", *metricspath, m.Name, err)
+		}
+	}
+
+	e := &metricsExporter{
+		base:       cfg,
+		filterfile: *vo.filterfile,
+		deadline:   vo.deadline,
+		metrics:    ecfg.Metrics,
+		logger:     slog.New(slog.NewTextHandler(os.Stderr, nil)),
+		state:      make(map[string]metricState),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		ticker := time.NewTicker(ecfg.interval)
+		defer ticker.Stop()
+		for {
+			e.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", e.handleMetrics)
+	return vo.serve(ctx, mux, e.logger)
+}
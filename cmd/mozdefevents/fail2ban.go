@@ -0,0 +1,292 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bruteEvent is a brute force event parsed from a syslog summary, either a
+// fail2ban ban, unban or found match, or a failed sshd authentication
+type bruteEvent struct {
+	Event  string
+	Jail   string
+	Source string
+	User   string
+}
+
+// The fail2ban action and filter messages, the summary may carry the
+// logger name, pid and level before the jail depending on how the event
+// was ingested
+var fail2banRe = regexp.MustCompile(`\[([^\]\s]+)\] (Ban|Unban|Restore Ban|Found) ([0-9A-Fa-f.:]+)`)
+
+// The programs fail2ban logs as, and the summary words of the events
+var (
+	fail2banPrograms = []string{"fail2ban", "fail2ban.actions", "fail2ban.filter", "fail2ban-server", "sshd"}
+	fail2banWords    = []string{"Ban", "Unban", "Found", "Failed", "Invalid"}
+)
+
+// Parse a fail2ban or sshd summary, returning false if it is not a brute
+// force event
+func parseBruteEvent(program string, summary string) (bruteEvent, bool) {
+	if program == "sshd" {
+		a, ok := parseSSHAuth(summary)
+		if !ok || a.Success {
+			return bruteEvent{}, false
+		}
+		return bruteEvent{Event: "failure", Source: a.Source, User: a.User}, true
+	}
+	if !strings.HasPrefix(program, "fail2ban") {
+		return bruteEvent{}, false
+	}
+	m := fail2banRe.FindStringSubmatch(summary)
+	if m == nil {
+		return bruteEvent{}, false
+	}
+	ev := "ban"
+	switch m[2] {
+	case "Unban":
+		ev = "unban"
+	case "Found":
+		ev = "found"
+	}
+	return bruteEvent{Event: ev, Jail: m[1], Source: m[3]}, true
+}
+
+// fail2banFilter selects the events shown by the fail2ban subcommand
+type fail2banFilter struct {
+	jail   string
+	source string
+	event  string
+}
+
+func (f fail2banFilter) match(e mozdefevents.Event) bool {
+	b, ok := parseBruteEvent(e.Details.Program, e.Summary)
+	if !ok {
+		return false
+	}
+	switch {
+	case f.jail != "" && b.Jail != f.jail:
+		return false
+	case f.source != "" && b.Source != f.source:
+		return false
+	case f.event != "" && b.Event != f.event:
+		return false
+	}
+	return true
+}
+
+// Build a search for fail2ban and failed sshd authentication messages, the
+// criteria narrow the search and the events are then matched exactly by
+// fail2banFilter
+func (cfg *config) buildFail2banSearch(f fail2banFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("category", "syslog")
+	programs := fail2banPrograms
+	words := fail2banWords
+	switch {
+	case f.jail != "" || f.event == "ban" || f.event == "unban" || f.event == "found":
+		programs = programs[:len(programs)-1]
+		words = words[:3]
+	case f.event == "failure":
+		programs = programs[len(programs)-1:]
+		words = words[3:]
+	}
+	clause, err := cfg.matchValuesClause("details.program", programs)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	clause, err = cfg.matchValuesClause("summary", words)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if f.jail != "" {
+		ret.AddMatch("summary", f.jail)
+	}
+	if f.source != "" {
+		ret.AddMatch("summary", f.source)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// bruteSource holds the counts of brute force events from a source address
+type bruteSource struct {
+	failures int
+	found    int
+	bans     int
+	unbans   int
+	users    map[string]bool
+	last     time.Time
+}
+
+// bruteSources counts brute force events per source address, collected
+// with -by-source and shown once the search completes
+type bruteSources struct {
+	sources     map[string]*bruteSource
+	minFailures int
+	tsField     string
+}
+
+func newBruteSources(minFailures int, tsField string) *bruteSources {
+	return &bruteSources{
+		sources:     make(map[string]*bruteSource),
+		minFailures: minFailures,
+		tsField:     tsField,
+	}
+}
+
+func (b *bruteSources) add(results []mozdefevents.Event) {
+	for _, x := range results {
+		ev, ok := parseBruteEvent(x.Details.Program, x.Summary)
+		if !ok {
+			continue
+		}
+		s, ok := b.sources[ev.Source]
+		if !ok {
+			s = &bruteSource{users: make(map[string]bool)}
+			b.sources[ev.Source] = s
+		}
+		switch ev.Event {
+		case "failure":
+			s.failures++
+		case "found":
+			s.found++
+		case "ban":
+			s.bans++
+		case "unban":
+			s.unbans++
+		}
+		if ev.User != "" {
+			s.users[ev.User] = true
+		}
+		if t := x.Time(b.tsField); t.After(s.last) {
+			s.last = t
+		}
+	}
+}
+
+// Show the source addresses with the most authentication failures first,
+// failures include the sshd failures and the matches found by fail2ban
+func (b *bruteSources) render(w io.Writer, cfg *config) {
+	keys := make([]string, 0, len(b.sources))
+	for k, v := range b.sources {
+		if v.failures+v.found >= b.minFailures {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		x, y := b.sources[keys[i]], b.sources[keys[j]]
+		if x.failures+x.found != y.failures+y.found {
+			return x.failures+x.found > y.failures+y.found
+		}
+		if x.bans != y.bans {
+			return x.bans > y.bans
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "%8v %8v %6v %6v %6v %-25v %v\n", "failures", "found", "bans", "unbans", "users", "last", "source")
+	for _, x := range keys {
+		s := b.sources[x]
+		fmt.Fprintf(w, "%8v %8v %6v %6v %6v %-25v %v\n", s.failures, s.found, s.bans, s.unbans,
+			len(s.users), cfg.displayTime(s.last).Format(time.RFC3339), x)
+	}
+}
+
+// Show fail2ban and sshd failure events, or count them per source address,
+// other events such as those shown with -context are shown as syslog events
+func (cfg *config) fail2banResults(results []mozdefevents.Event) {
+	if cfg.bruteSources != nil {
+		cfg.bruteSources.add(results)
+		return
+	}
+	for _, x := range results {
+		b, ok := parseBruteEvent(x.Details.Program, x.Summary)
+		if !ok {
+			cfg.syslogResults([]mozdefevents.Event{x})
+			continue
+		}
+		var evstr string
+		if b.Event == "failure" {
+			evstr = fmt.Sprintf("[fail2ban] failure from:%v user:%v", b.Source, b.User)
+		} else {
+			evstr = fmt.Sprintf("[fail2ban] %v from:%v jail:%v", b.Event, b.Source, b.Jail)
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Details.Hostname), evstr)
+	}
+}
+
+func (cfg *config) runFail2ban(args []string) error {
+	fs := cfg.newFlagSet("fail2ban", "", "Search for fail2ban ban, unban and found events along with failed sshd\n"+
+		"authentications, showing the source address of each. With -by-source the events\n"+
+		"are counted per source address and shown once the search completes, the sources\n"+
+		"with the most failures first.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f fail2banFilter
+	fs.StringVar(&f.jail, "jail", "", "match fail2ban events for jail (e.g., sshd)")
+	fs.StringVar(&f.source, "from", "", "match events from source address")
+	fs.StringVar(&f.event, "event", "", "match events of type, ban, unban, found or failure")
+	bysrc := fs.Bool("by-source", false, "count events per source address, shown once the search completes")
+	minfail := fs.Int("min-failures", 0, "with -by-source, only show sources with at least n failures")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch f.event {
+	case "", "ban", "unban", "found", "failure":
+	default:
+		return errors.New("-event must be ban, unban, found or failure")
+	}
+	if f.jail != "" && f.event == "failure" {
+		return errors.New("-jail cannot be combined with -event failure")
+	}
+	if *minfail < 0 {
+		return errors.New("-min-failures must not be negative")
+	}
+	if *minfail > 0 && !*bysrc {
+		return errors.New("-min-failures requires -by-source")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	if *bysrc {
+		if cfg.follow != nil || cfg.tui != nil || *eo.output != "" || eo.histinterval > 0 || *eo.unique != "" {
+			return errors.New("-by-source cannot be combined with -f, -tui, -output, -histogram or -unique")
+		}
+		cfg.bruteSources = newBruteSources(*minfail, cfg.tsField)
+	}
+	cfg.mode = MODEFAIL2BAN
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildFail2banSearch(f)
+	}
+	return cfg.runSearch(so, eo, "fail2ban", build, "event")
+}
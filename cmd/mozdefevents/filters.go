@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A named filter set expands into query clauses, for example
+//
+//	{
+//	    "noisy-hosts": {
+//	        "must_not": [ {"query_string": {"query": "hostname: /ci[0-9]+/"}} ]
+//	    },
+//	    "prod-web": {
+//	        "must": [ {"query_string": {"query": "hostname: /web[0-9]+\\.prod/"}} ]
+//	    }
+//	}
+type filterSet struct {
+	Must    []json.RawMessage `json:"must"`
+	MustNot []json.RawMessage `json:"must_not"`
+}
+
+func defaultFilterPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mozdefevents", "filters.json")
+}
+
+func loadFilters(path string) (map[string]filterSet, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]filterSet)
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return ret, nil
+}
+
+// Resolve the named filter sets from the filter file
+func resolveFilters(path string, names []string) ([]filterSet, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no filter file available")
+	}
+	filters, err := loadFilters(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]filterSet, 0)
+	for _, x := range names {
+		f, ok := filters[x]
+		if !ok {
+			return nil, fmt.Errorf("filter %q not found in %v", x, path)
+		}
+		ret = append(ret, f)
+	}
+	return ret, nil
+}
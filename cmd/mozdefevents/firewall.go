@@ -0,0 +1,157 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strings"
+)
+
+// firewallFilter selects the connections shown by the firewall subcommand
+type firewallFilter struct {
+	source string
+	dest   string
+	port   string
+	proto  string
+	action string
+}
+
+func (f firewallFilter) match(e mozdefevents.Event) bool {
+	d := e.Details
+	if d.SourceIPAddress == "" || d.DestinationIPAddress == "" {
+		return false
+	}
+	switch {
+	case f.source != "" && d.SourceIPAddress != f.source:
+		return false
+	case f.dest != "" && d.DestinationIPAddress != f.dest:
+		return false
+	case f.port != "" && string(d.DestinationPort) != f.port:
+		return false
+	case f.proto != "" && !strings.EqualFold(d.Proto, f.proto):
+		return false
+	case f.action != "" && d.Action != f.action:
+		return false
+	}
+	return true
+}
+
+// Build a search for firewall events, either events categorized as firewall
+// events or netfilter log messages. The connections are then matched exactly
+// by firewallFilter.
+func (cfg *config) buildFirewallSearch(f firewallFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	should := []mozdefevents.Criteria{
+		{Match: map[string]string{"category": "firewall"}},
+		{Match: map[string]string{"summary": "DST"}},
+	}
+	clause, err := cfg.shouldClause(should)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	// The addresses are matched against the structured fields, or the
+	// summary of netfilter log messages which are parsed once fetched
+	for _, x := range []struct{ field, addr string }{
+		{"details.sourceipaddress", f.source},
+		{"details.destinationipaddress", f.dest},
+	} {
+		if x.addr == "" {
+			continue
+		}
+		clause, err = cfg.matchAnyClause([]string{x.field, "summary"}, x.addr)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Return an address and port for display, the port is omitted for
+// protocols without ports
+func displayAddr(addr string, port mozdefevents.Port) string {
+	if port == "" {
+		return addr
+	}
+	if strings.Contains(addr, ":") {
+		return fmt.Sprintf("[%v]:%v", addr, port)
+	}
+	return fmt.Sprintf("%v:%v", addr, port)
+}
+
+// Show firewall events as connections, other events such as those shown
+// with -context are shown as query results
+func (cfg *config) firewallResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		if d.SourceIPAddress == "" || d.DestinationIPAddress == "" {
+			cfg.queryResults([]mozdefevents.Event{x})
+			continue
+		}
+		action := d.Action
+		if action == "" {
+			action = "unknown"
+		}
+		proto := d.Proto
+		if proto == "" {
+			proto = "unknown"
+		}
+		host := x.Hostname
+		if host == "" {
+			host = d.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v [firewall] %v %v %v -> %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), action, proto, displayAddr(d.SourceIPAddress, d.SourcePort),
+			displayAddr(d.DestinationIPAddress, d.DestinationPort))
+	}
+}
+
+func (cfg *config) runFirewall(args []string) error {
+	fs := cfg.newFlagSet("firewall", "", "Search for firewall events such as iptables and nftables log messages, showing\n"+
+		"the action, protocol, source and destination of each connection.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f firewallFilter
+	fs.StringVar(&f.source, "src", "", "match connections from source address")
+	fs.StringVar(&f.dest, "dst", "", "match connections to destination address")
+	fs.StringVar(&f.port, "port", "", "match connections to destination port")
+	fs.StringVar(&f.proto, "proto", "", "match connections using protocol (e.g., tcp, udp, icmp)")
+	fs.StringVar(&f.action, "action", "", "match connections with action, accept or drop")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if f.action != "" && f.action != "accept" && f.action != "drop" {
+		return errors.New("-action must be accept or drop")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEFIREWALL
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildFirewallSearch(f)
+	}
+	return cfg.runSearch(so, eo, "firewall", build, "event")
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"github.com/ameihm0912/mozdefevents"
+	"time"
+)
+
+const followInterval = time.Second * 5
+
+// Each window overlaps the previous by followGrace, so events indexed late
+// with an older timestamp are still shown if they arrive within it
+const followGrace = time.Minute * 2
+
+// followState tracks the newest event seen, along with the IDs of the events
+// seen within followGrace of it, since the next window overlaps them
+type followState struct {
+	last time.Time
+	ids  map[string]time.Time
+}
+
+// Record results that have been shown and return only those not seen in a
+// previous window
+func (f *followState) track(results []mozdefevents.Event, tsField string) []mozdefevents.Event {
+	if f.ids == nil {
+		f.ids = make(map[string]time.Time)
+	}
+	ret := make([]mozdefevents.Event, 0, len(results))
+	for _, x := range results {
+		if _, ok := f.ids[x.ID]; ok {
+			continue
+		}
+		ts := x.Time(tsField)
+		if ts.After(f.last) {
+			f.last = ts
+		}
+		f.ids[x.ID] = ts
+		ret = append(ret, x)
+	}
+	for k, v := range f.ids {
+		if v.Before(f.last.Add(-followGrace)) {
+			delete(f.ids, k)
+		}
+	}
+	return ret
+}
+
+// Repeatedly query for events newer than the last event seen, printing new
+// events as they arrive. The window starts followGrace before the newest
+// event seen and ends at the current time, so the indices queried roll over
+// with the date.
+func (cfg *config) followQuery(build func() (mozdefevents.Query, error), doctype string) error {
+	if cfg.follow.last.IsZero() {
+		cfg.follow.last = cfg.endDate
+	}
+	for {
+		err := cfg.pause(followInterval)
+		if err != nil {
+			return err
+		}
+		cfg.startDate = cfg.follow.last.Add(-followGrace)
+		cfg.endDate = time.Now().UTC()
+		qry, err := build()
+		if err != nil {
+			return err
+		}
+		err = cfg.streamEvents(cfg.ctx, qry, cfg.indicesForRange(cfg.startDate, cfg.endDate), doctype, cfg.handleResults)
+		if err != nil {
+			return err
+		}
+	}
+}
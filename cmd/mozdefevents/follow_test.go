@@ -0,0 +1,51 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"github.com/ameihm0912/mozdefevents"
+	"testing"
+	"time"
+)
+
+func followEvent(id string, ts time.Time) mozdefevents.Event {
+	return mozdefevents.Event{ID: id, UTCTimestamp: ts}
+}
+
+func TestFollowNoInitialEvents(t *testing.T) {
+	end := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	// As seeded by followQuery when the initial search returned nothing
+	f := &followState{last: end}
+	got := f.track([]mozdefevents.Event{followEvent("a", end), followEvent("b", end.Add(time.Second))}, "utctimestamp")
+	if len(got) != 2 {
+		t.Fatalf("got %v events, want 2", len(got))
+	}
+	got = f.track([]mozdefevents.Event{followEvent("a", end), followEvent("b", end.Add(time.Second))}, "utctimestamp")
+	if len(got) != 0 {
+		t.Errorf("got %v events from the overlapping window, want 0", len(got))
+	}
+}
+
+func TestFollowLateEvents(t *testing.T) {
+	end := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	f := &followState{}
+	f.track([]mozdefevents.Event{followEvent("a", end)}, "utctimestamp")
+	// Indexed late with a timestamp before the newest event seen, but within
+	// the grace period the next window overlaps
+	got := f.track([]mozdefevents.Event{followEvent("a", end), followEvent("late", end.Add(-time.Minute))}, "utctimestamp")
+	if len(got) != 1 || got[0].ID != "late" {
+		t.Errorf("got %v, want only the late event", got)
+	}
+	if !f.last.Equal(end) {
+		t.Errorf("last moved to %v", f.last)
+	}
+	f.track([]mozdefevents.Event{followEvent("c", end.Add(followGrace*2))}, "utctimestamp")
+	if _, ok := f.ids["a"]; ok || len(f.ids) != 1 {
+		t.Errorf("ids outside the grace period were kept, %v", f.ids)
+	}
+}
@@ -0,0 +1,260 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/ameihm0912/mozdefevents"
+	"github.com/ameihm0912/mozdefevents/eventspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// grpcServer implements the event service, each search is run with a copy
+// of the server configuration sharing its client
+type grpcServer struct {
+	eventspb.UnimplementedEventServiceServer
+
+	base       *config
+	filterfile string
+	maxLimit   int
+	deadline   time.Duration
+	logger     *slog.Logger
+}
+
+// Convert a search request message to the request used by serve
+func searchRequestProto(m *eventspb.SearchRequest) searchRequest {
+	return searchRequest{
+		Type:       m.GetType(),
+		Begin:      m.GetBegin(),
+		End:        m.GetEnd(),
+		Last:       m.GetLast(),
+		Hosts:      m.GetHosts(),
+		HostNoCase: m.GetHostnocase(),
+		Keyword:    m.GetKeyword(),
+		Tags:       m.GetTags(),
+		Groups:     m.GetGroups(),
+		Severity:   m.GetSeverity(),
+		OrigUser:   m.GetOriguser(),
+		Range:      m.GetRange(),
+		Filters:    m.GetFilters(),
+		Sort:       m.GetSort(),
+		Limit:      int(m.GetLimit()),
+		AuditType:  m.GetAtype(),
+		Session:    m.GetSes(),
+		Program:    m.GetProgram(),
+		Facility:   m.GetFacility(),
+		DocType:    m.GetDoctype(),
+	}
+}
+
+// Return the timestamp message for t, or nil if t is not set
+func timestampProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// Convert an event to its message
+func eventProto(e mozdefevents.Event) *eventspb.Event {
+	d := e.Details
+	return &eventspb.Event{
+		Id:                e.ID,
+		Cluster:           e.Cluster,
+		Category:          e.Category,
+		Hostname:          e.Hostname,
+		Timestamp:         timestampProto(e.Timestamp),
+		Utctimestamp:      timestampProto(e.UTCTimestamp),
+		Receivedtimestamp: timestampProto(e.ReceivedTimestamp),
+		Summary:           e.Summary,
+		Severity:          e.Severity,
+		Tags:              e.Tags,
+		Details: &eventspb.EventDetails{
+			Hostname:        d.Hostname,
+			Command:         d.Command,
+			Dhost:           d.DHost,
+			Dproc:           d.DProc,
+			Duser:           d.DUser,
+			Suser:           d.SUser,
+			Fname:           d.Fname,
+			Name:            d.Name,
+			Processname:     d.ProcessName,
+			Originaluser:    d.OriginalUser,
+			User:            d.User,
+			Path:            d.Path,
+			Program:         d.Program,
+			Auditkey:        d.AuditKey,
+			Ses:             d.Ses,
+			AssetGroup:      d.AssetGroup,
+			Sourceipaddress: d.SourceIPAddress,
+			Sourcehostname:  d.SourceHostname,
+		},
+		Raw: e.Raw,
+	}
+}
+
+// Return the status for a failed search
+func searchStatus(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(context.Cause(ctx), errDeadline):
+		return status.Error(codes.DeadlineExceeded, errDeadline.Error())
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Search streams the events matching the request as they are fetched. Send
+// blocks while the client is not reading, which holds the search until the
+// client catches up.
+func (s *grpcServer) Search(req *eventspb.SearchRequest, stream grpc.ServerStreamingServer[eventspb.Event]) error {
+	start := time.Now()
+	sreq := searchRequestProto(req)
+	cfg, build, doctype, err := s.base.requestConfig(sreq, s.filterfile)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if s.maxLimit > 0 && (cfg.limit == 0 || cfg.limit > s.maxLimit) {
+		cfg.limit = s.maxLimit
+	}
+	qry, err := build()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx := stream.Context()
+	if s.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, s.deadline, errDeadline)
+		defer cancel()
+	}
+	cfg.ctx = ctx
+	cfg.sink = func(results []mozdefevents.Event) error {
+		for _, x := range results {
+			err := stream.Send(eventProto(x))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = cfg.runQuery(ctx, qry, doctype)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		s.logger.Error("search failed", "type", sreq.Type, "events", cfg.collected, "elapsed", elapsed, "error", err)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return searchStatus(ctx, err)
+	}
+	s.logger.Info("search", "type", sreq.Type, "start", cfg.startDate, "end", cfg.endDate,
+		"events", cfg.collected, "elapsed", elapsed)
+	return nil
+}
+
+// Return an error unless the request metadata carries the bearer token
+func (o *serverOptions) grpcAuthorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, x := range md.Get("authorization") {
+		if o.authorized(x) {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+// Return the gRPC server options authenticating clients as configured by
+// the server flags
+func (o *serverOptions) grpcOptions() []grpc.ServerOption {
+	ret := make([]grpc.ServerOption, 0)
+	if o.tlsConfig != nil {
+		ret = append(ret, grpc.Creds(credentials.NewTLS(o.tlsConfig)))
+	}
+	if o.token == "" {
+		return ret
+	}
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := o.grpcAuthorize(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := o.grpcAuthorize(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	return append(ret, grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+}
+
+// Serve the event service over gRPC until interrupted
+func (cfg *config) runGRPC(args []string) error {
+	fs := cfg.newFlagSet("grpc", "", "Serve the gRPC event service defined in eventspb/events.proto, streaming the\n"+
+		"normalized events matching each search. The search request takes the same fields as a\n"+
+		"serve search request. If MOZDEFSERVETOKEN is set, calls must carry it in authorization\n"+
+		"metadata as a bearer token.")
+	vo := cfg.addServerFlags(fs, "localhost:9090")
+	maxLimit := fs.Int("max-events", 0, "maximum number of events returned by a search (0 for no limit)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *maxLimit < 0 {
+		return errors.New("-max-events must not be negative")
+	}
+	err = vo.apply(cfg)
+	if err != nil {
+		return err
+	}
+	s := &grpcServer{
+		base:       cfg,
+		filterfile: *vo.filterfile,
+		maxLimit:   *maxLimit,
+		deadline:   vo.deadline,
+		logger:     slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	}
+	lis, err := net.Listen("tcp", *vo.listen)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(vo.grpcOptions()...)
+	eventspb.RegisterEventServiceServer(srv, s)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errch := make(chan error, 1)
+	go func() {
+		errch <- srv.Serve(lis)
+	}()
+	s.logger.Info("listening", "address", lis.Addr().String())
+	select {
+	case err = <-errch:
+		return err
+	case <-ctx.Done():
+	}
+	s.logger.Info("server stopping, waiting for searches in progress")
+	t := time.AfterFunc(serveStopDelay, srv.Stop)
+	defer t.Stop()
+	srv.GracefulStop()
+	return nil
+}
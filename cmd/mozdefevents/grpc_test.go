@@ -0,0 +1,42 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestGRPCAuthorize(t *testing.T) {
+	o := newServerOptions("localhost:9090", "secret")
+	if len(o.grpcOptions()) != 2 {
+		t.Errorf("expected unary and stream interceptors with a token")
+	}
+	for _, x := range []struct {
+		md   metadata.MD
+		want codes.Code
+	}{
+		{nil, codes.Unauthenticated},
+		{metadata.Pairs("authorization", "Bearer wrong"), codes.Unauthenticated},
+		{metadata.Pairs("authorization", "Bearer secret"), codes.OK},
+	} {
+		ctx := context.Background()
+		if x.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, x.md)
+		}
+		if got := status.Code(o.grpcAuthorize(ctx)); got != x.want {
+			t.Errorf("%v: got %v, want %v", x.md, got, x.want)
+		}
+	}
+	if len(newServerOptions("localhost:9090", "").grpcOptions()) != 0 {
+		t.Errorf("expected no server options without TLS or a token")
+	}
+}
@@ -0,0 +1,189 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// The fields of a GuardDuty finding event, these are read from the event
+// document as the finding is not part of the normalized event
+const (
+	guarddutyTypeField     = "details.finding.type"
+	guarddutySeverityField = "details.finding.severity"
+	guarddutyResourceField = "details.finding.resource.resourcetype"
+	guarddutyInstanceField = "details.finding.resource.instancedetails.instanceid"
+	guarddutyAccountField  = "details.finding.accountid"
+	guarddutyRegionField   = "details.finding.region"
+)
+
+var guarddutyFields = []string{
+	guarddutyTypeField, guarddutySeverityField, guarddutyResourceField,
+	guarddutyInstanceField, guarddutyAccountField, guarddutyRegionField,
+}
+
+// guarddutyFinding is a finding read from a GuardDuty event
+type guarddutyFinding struct {
+	Type     string
+	Severity float64
+	Resource string
+	Account  string
+	Region   string
+}
+
+// Read the finding from a GuardDuty event, fields missing from the event are
+// left empty
+func readFinding(e mozdefevents.Event) guarddutyFinding {
+	var ret guarddutyFinding
+	v := func(path string) string {
+		s, _ := e.FieldValue(path)
+		return s
+	}
+	ret.Type = v(guarddutyTypeField)
+	ret.Severity, _ = strconv.ParseFloat(v(guarddutySeverityField), 64)
+	ret.Resource = v(guarddutyResourceField)
+	if id := v(guarddutyInstanceField); id != "" {
+		ret.Resource += "/" + id
+	}
+	ret.Account = v(guarddutyAccountField)
+	ret.Region = v(guarddutyRegionField)
+	return ret
+}
+
+// Return the GuardDuty severity level for a severity value
+func guarddutyLevel(severity float64) string {
+	switch {
+	case severity >= 7:
+		return "high"
+	case severity >= 4:
+		return "medium"
+	}
+	return "low"
+}
+
+// findingList holds the findings collected with -by-severity, which are
+// shown once the search completes
+type findingList []mozdefevents.Event
+
+// Show the findings with the most severe first, findings of the same
+// severity remain in the order they were found
+func (cfg *config) renderFindings() {
+	findings := make([]guarddutyFinding, len(cfg.findings))
+	for i, x := range cfg.findings {
+		findings[i] = readFinding(x)
+	}
+	idx := make([]int, len(findings))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return findings[idx[i]].Severity > findings[idx[j]].Severity
+	})
+	for _, x := range idx {
+		cfg.showFinding(cfg.findings[x], findings[x])
+	}
+}
+
+func (cfg *config) showFinding(e mozdefevents.Event, f guarddutyFinding) {
+	ftype := f.Type
+	if ftype == "" {
+		ftype = "unknown"
+	}
+	evstr := fmt.Sprintf("[guardduty] %v (%v %v)", ftype, guarddutyLevel(f.Severity),
+		strconv.FormatFloat(f.Severity, 'f', -1, 64))
+	if f.Resource != "" {
+		evstr += " resource:" + f.Resource
+	}
+	if f.Account != "" {
+		evstr += " account:" + f.Account
+	}
+	if f.Region != "" {
+		evstr += " region:" + f.Region
+	}
+	host := e.Hostname
+	if host == "" {
+		host = "-"
+	}
+	fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(e.Timestamp), displayHost(e, host), evstr)
+}
+
+// Show GuardDuty findings, or collect them to be shown by severity
+func (cfg *config) guarddutyResults(results []mozdefevents.Event) {
+	if cfg.findings != nil {
+		cfg.findings = append(cfg.findings, results...)
+		return
+	}
+	for _, x := range results {
+		cfg.showFinding(x, readFinding(x))
+	}
+}
+
+func (cfg *config) buildGuardDutySearch(ftype string, minsev float64) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("source", "guardduty")
+	if ftype != "" {
+		ret.AddMatch(guarddutyTypeField, ftype)
+	}
+	if minsev > 0 {
+		var qc mozdefevents.Criteria
+		qc.Range = map[string]map[string]string{
+			guarddutySeverityField: {"gte": strconv.FormatFloat(minsev, 'f', -1, 64)},
+		}
+		ret.Query.Bool.Must = append(ret.Query.Bool.Must, qc)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+func (cfg *config) runGuardDuty(args []string) error {
+	fs := cfg.newFlagSet("guardduty", "", "Search for AWS GuardDuty finding events, showing the finding type, severity,\n"+
+		"resource and account of each.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	ftype := fs.String("ftype", "", "match findings of type (e.g., Recon:EC2/PortProbeUnprotectedPort)")
+	minsev := fs.Float64("min-severity", 0, "match findings with at least severity (e.g., 7 for high)")
+	bysev := fs.Bool("by-severity", false, "show findings once the search completes, most severe first")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *minsev < 0 {
+		return errors.New("-min-severity must not be negative")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	if *bysev {
+		if cfg.follow != nil || cfg.tui != nil || *eo.output != "" {
+			return errors.New("-by-severity cannot be combined with -f, -tui or -output")
+		}
+		cfg.findings = findingList{}
+	}
+	cfg.mode = MODEGUARDDUTY
+	cfg.extraFields = guarddutyFields
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildGuardDutySearch(*ftype, *minsev)
+	}
+	return cfg.runSearch(so, eo, "guardduty", build, "event")
+}
@@ -0,0 +1,111 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"github.com/mattn/go-runewidth"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// heatmap counts events per host per hour of day (UTC) of the timestamp
+// field in use
+type heatmap map[string]*[24]int
+
+var heatmapShades = []rune{' ', '░', '▒', '▓', '█'}
+
+func (h heatmap) add(results []mozdefevents.Event, tsField string) {
+	for _, x := range results {
+		host := x.Hostname
+		if host == "" {
+			host = x.Details.Hostname
+		}
+		if host == "" {
+			host = "unknown"
+		}
+		if _, ok := h[host]; !ok {
+			h[host] = &[24]int{}
+		}
+		h[host][x.Time(tsField).UTC().Hour()]++
+	}
+}
+
+func (h heatmap) hosts() []string {
+	ret := make([]string, 0, len(h))
+	for k := range h {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Render the matrix using shaded cells scaled against the busiest cell,
+// with the total for each host in the last column
+func (h heatmap) render(w io.Writer) {
+	hosts := h.hosts()
+	width := runewidth.StringWidth("host")
+	max := 0
+	for _, x := range hosts {
+		if runewidth.StringWidth(x) > width {
+			width = runewidth.StringWidth(x)
+		}
+		for _, c := range h[x] {
+			if c > max {
+				max = c
+			}
+		}
+	}
+	// Pad using display width rather than byte length so hostnames
+	// containing wide characters keep the columns aligned
+	fmt.Fprintf(w, "%v ", runewidth.FillRight("host", width))
+	for i := 0; i < 24; i++ {
+		fmt.Fprintf(w, "%02d ", i)
+	}
+	fmt.Fprintf(w, "total\n")
+	for _, x := range hosts {
+		fmt.Fprintf(w, "%v ", runewidth.FillRight(x, width))
+		total := 0
+		for _, c := range h[x] {
+			total += c
+			shade := heatmapShades[0]
+			if c > 0 {
+				shade = heatmapShades[1+(c*(len(heatmapShades)-2))/max]
+			}
+			fmt.Fprintf(w, "%c%c ", shade, shade)
+		}
+		fmt.Fprintf(w, "%v\n", total)
+	}
+}
+
+func (h heatmap) renderCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	hdr := []string{"host"}
+	for i := 0; i < 24; i++ {
+		hdr = append(hdr, fmt.Sprintf("%02d", i))
+	}
+	err := cw.Write(hdr)
+	if err != nil {
+		return err
+	}
+	for _, x := range h.hosts() {
+		row := []string{x}
+		for _, c := range h[x] {
+			row = append(row, strconv.Itoa(c))
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,353 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultIndexPattern = "events-%Y%m%d"
+
+// strftime directives supported in index patterns and the equivalent Go
+// time layout, each layout is as wide as the value it formats
+var strftimeLayout = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'j': "002",
+}
+
+// The prefix marking an index pattern given as a Go time layout
+const layoutPrefix = "layout:"
+
+// indexPattern names the indices searched, either a strftime style pattern
+// such as events-%Y.%m.%d, a Go time layout given with the layout: prefix
+// such as layout:events-2006.01.02, or a static index or alias name
+type indexPattern string
+
+// patternPart is a part of an index pattern, literal text or a date
+// formatted with a Go time layout
+type patternPart struct {
+	literal string
+	layout  string
+}
+
+// Split the pattern into literal text and date parts. The literal text of
+// a strftime pattern is kept apart from the layouts so digits or layout
+// tokens in index names are not formatted as dates.
+func (p indexPattern) parts() ([]patternPart, error) {
+	s := string(p)
+	if strings.HasPrefix(s, layoutPrefix) {
+		l := strings.TrimPrefix(s, layoutPrefix)
+		if l == "" {
+			return nil, fmt.Errorf("index pattern %q has an empty layout", s)
+		}
+		return []patternPart{{layout: l}}, nil
+	}
+	ret := make([]patternPart, 0)
+	var lit strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			lit.WriteByte(s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return nil, fmt.Errorf("index pattern %q ends with %%", s)
+		}
+		i++
+		if s[i] == '%' {
+			lit.WriteByte('%')
+			continue
+		}
+		l, ok := strftimeLayout[s[i]]
+		if !ok {
+			return nil, fmt.Errorf("index pattern %q: unsupported directive %%%c", s, s[i])
+		}
+		if lit.Len() > 0 {
+			ret = append(ret, patternPart{literal: lit.String()})
+			lit.Reset()
+		}
+		ret = append(ret, patternPart{layout: l})
+	}
+	if lit.Len() > 0 {
+		ret = append(ret, patternPart{literal: lit.String()})
+	}
+	return ret, nil
+}
+
+// Two reference dates that differ in every date component, used to find
+// the date dependent part of a pattern
+var (
+	patternRefA = time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC)
+	patternRefB = time.Date(2011, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// A static pattern names a single index or alias regardless of date
+func (p indexPattern) static() bool {
+	if _, err := p.parts(); err != nil {
+		return false
+	}
+	return p.format(patternRefA) == p.format(patternRefB)
+}
+
+// Return the literal prefix of the index names before the date
+func (p indexPattern) prefix() string {
+	a := p.format(patternRefA)
+	b := p.format(patternRefB)
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+func (p indexPattern) format(t time.Time) string {
+	parts, _ := p.parts()
+	var b strings.Builder
+	for _, x := range parts {
+		if x.layout == "" {
+			b.WriteString(x.literal)
+			continue
+		}
+		b.WriteString(t.UTC().Format(x.layout))
+	}
+	return b.String()
+}
+
+// Parse the date of an index named with the pattern. The literal text must
+// match exactly, strftime dates are read by width and a Go layout reads the
+// remainder of the name.
+func (p indexPattern) parse(name string) (time.Time, error) {
+	parts, err := p.parts()
+	if err != nil {
+		return time.Time{}, err
+	}
+	rest := name
+	layouts := make([]string, 0, len(parts))
+	values := make([]string, 0, len(parts))
+	for i, x := range parts {
+		if x.layout == "" {
+			if !strings.HasPrefix(rest, x.literal) {
+				return time.Time{}, fmt.Errorf("index %q does not match pattern %q", name, p)
+			}
+			rest = rest[len(x.literal):]
+			continue
+		}
+		n := len(x.layout)
+		if i == len(parts)-1 && strings.HasPrefix(string(p), layoutPrefix) {
+			n = len(rest)
+		}
+		if len(rest) < n {
+			return time.Time{}, fmt.Errorf("index %q does not match pattern %q", name, p)
+		}
+		layouts = append(layouts, x.layout)
+		values = append(values, rest[:n])
+		rest = rest[n:]
+	}
+	if rest != "" || len(layouts) == 0 {
+		return time.Time{}, fmt.Errorf("index %q does not match pattern %q", name, p)
+	}
+	return time.Parse(strings.Join(layouts, "|"), strings.Join(values, "|"))
+}
+
+// Set the index pattern used for the search, checking it is valid. If an
+// alias is given it is searched instead of enumerating daily indices and
+// the time range alone selects the events.
+func (cfg *config) setIndexPattern(s string, alias string) error {
+	cfg.alias = alias
+	p := indexPattern(s)
+	if _, err := p.parts(); err != nil {
+		return err
+	}
+	cfg.indexPattern = p
+	return nil
+}
+
+// Skip an index that does not exist, returning err otherwise. Daily indices
+// can be missing due to gaps in ingestion or retention expiry, and this
+// should not end the run.
+func skipMissing(index string, err error) error {
+	if !mozdefevents.IsIndexNotFound(err) {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "warning: index %v not found, skipping\n", index)
+	return nil
+}
+
+// Remove the indices that do not exist in the cluster, checked with a
+// single request up front instead of a failed search per index
+func (cfg *config) existingIndices(indices []string) ([]string, error) {
+	if cfg.alias != "" || cfg.indexPattern.static() {
+		return indices, nil
+	}
+	conn, err := cfg.newConn()
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{"h": []string{"index"}, "format": []string{"json"}}
+	buf, err := conn.Request(cfg.ctx, "GET", "/_cat/indices/"+cfg.indexPattern.prefix()+"*", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	var idxlist []catIndex
+	err = json.Unmarshal(buf, &idxlist)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool)
+	for _, x := range idxlist {
+		present[x.Index] = true
+	}
+	ret := make([]string, 0, len(indices))
+	for _, x := range indices {
+		// Indices on remote clusters are not listed locally
+		if !present[x] && !strings.Contains(x, ":") {
+			fmt.Fprintf(os.Stderr, "warning: index %v not found, skipping\n", x)
+			continue
+		}
+		ret = append(ret, x)
+	}
+	return ret, nil
+}
+
+// remoteCluster is a cluster searched with cross cluster search, indices
+// are named with the pattern or alias configured for the cluster
+type remoteCluster struct {
+	name    string
+	pattern indexPattern
+	alias   string
+}
+
+// Return the index for the cluster covering the day t
+func (r remoteCluster) index(t time.Time) string {
+	idx := r.alias
+	if idx == "" {
+		idx = r.pattern.format(t)
+	}
+	if r.name == "" {
+		return idx
+	}
+	return r.name + ":" + idx
+}
+
+// Set the remote clusters to search, each defaults to the local index
+// pattern or alias unless configured otherwise in the configuration file
+func (cfg *config) setRemotes(names []string) error {
+	cfg.remotes = nil
+	for _, x := range names {
+		if x == "" || strings.ContainsAny(x, ":,/") {
+			return fmt.Errorf("invalid remote cluster name %q", x)
+		}
+		r := remoteCluster{name: x, pattern: cfg.indexPattern, alias: cfg.alias}
+		if rc, ok := cfg.file.RemoteClusters[x]; ok {
+			if rc.IndexPattern != "" {
+				r.pattern = indexPattern(rc.IndexPattern)
+				if _, err := r.pattern.parts(); err != nil {
+					return err
+				}
+				r.alias = ""
+			}
+			if rc.Alias != "" {
+				r.alias = rc.Alias
+			}
+		}
+		cfg.remotes = append(cfg.remotes, r)
+	}
+	return nil
+}
+
+type catIndex struct {
+	Index string `json:"index"`
+}
+
+// Return the date of the oldest daily events index present in the cluster
+func (cfg *config) oldestEventsIndex() (time.Time, error) {
+	prefix := cfg.indexPattern.prefix()
+	var ret time.Time
+	conn, err := cfg.newConn()
+	if err != nil {
+		return ret, err
+	}
+	params := url.Values{"h": []string{"index"}, "format": []string{"json"}}
+	buf, err := conn.Request(cfg.ctx, "GET", "/_cat/indices/"+prefix+"*", params, nil)
+	if err != nil {
+		return ret, err
+	}
+	var idxlist []catIndex
+	err = json.Unmarshal(buf, &idxlist)
+	if err != nil {
+		return ret, err
+	}
+	for _, x := range idxlist {
+		t, err := cfg.indexPattern.parse(x.Index)
+		if err != nil {
+			continue
+		}
+		if ret.IsZero() || t.Before(ret) {
+			ret = t
+		}
+	}
+	if ret.IsZero() {
+		return ret, errors.New("no daily events indices found in cluster")
+	}
+	return ret, nil
+}
+
+// Searches starting more recently than retentionCheckAge are assumed to be
+// within the retention of the cluster, so the indices are only listed for
+// searches that could reach back past it
+const retentionCheckAge = 7 * 24 * time.Hour
+
+// Check the requested start date against the oldest index still retained
+// by the cluster, warning or clamping the start date if the search would
+// otherwise silently return partial results. The check is only made with
+// -clamp or for a start date older than retentionCheckAge. It is advisory,
+// if the oldest index cannot be found, such as when the credentials lack
+// the privilege to list indices, a warning is shown and the search
+// continues. Backends that cannot list indices are not checked.
+func (cfg *config) checkRetention() error {
+	// A static index or alias has no dates to check against
+	if cfg.alias != "" || cfg.indexPattern.static() {
+		return nil
+	}
+	if !cfg.clampStart && time.Since(cfg.startDate) < retentionCheckAge {
+		return nil
+	}
+	oldest, err := cfg.oldestEventsIndex()
+	if err != nil {
+		if cfg.ctx.Err() != nil {
+			return err
+		}
+		if !errors.Is(err, mozdefevents.ErrUnsupported) {
+			fmt.Fprintf(os.Stderr, "warning: unable to check index retention: %v\n", err)
+		}
+		return nil
+	}
+	if !cfg.startDate.Before(oldest) {
+		return nil
+	}
+	if cfg.clampStart {
+		fmt.Fprintf(os.Stderr, "notice: start date %v precedes oldest index "+
+			"%v, clamping start date\n", cfg.startDate.Format(time.RFC3339),
+			cfg.indexPattern.format(oldest))
+		cfg.startDate = oldest
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "warning: start date %v precedes oldest index "+
+		"%v, results before this date are not available\n",
+		cfg.startDate.Format(time.RFC3339), cfg.indexPattern.format(oldest))
+	return nil
+}
@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexPattern(t *testing.T) {
+	day := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pattern string
+		index   string
+		static  bool
+		prefix  string
+	}{
+		{"events-%Y%m%d", "events-20240305", false, "events-"},
+		{"logs-v1-%Y.%m.%d", "logs-v1-2024.03.05", false, "logs-v1-"},
+		{"events-v2", "events-v2", true, "events-v2"},
+		{"Jan-%Y-%j", "Jan-2024-065", false, "Jan-"},
+		{"pct%%-%y%m", "pct%-2403", false, "pct%-"},
+		{"layout:events-2006.01.02", "events-2024.03.05", false, "events-"},
+	}
+	for _, x := range tests {
+		p := indexPattern(x.pattern)
+		if _, err := p.parts(); err != nil {
+			t.Fatalf("%v: %v", x.pattern, err)
+		}
+		if got := p.format(day); got != x.index {
+			t.Errorf("%v: format got %v, want %v", x.pattern, got, x.index)
+		}
+		if got := p.static(); got != x.static {
+			t.Errorf("%v: static got %v, want %v", x.pattern, got, x.static)
+		}
+		if got := p.prefix(); got != x.prefix {
+			t.Errorf("%v: prefix got %v, want %v", x.pattern, got, x.prefix)
+		}
+		if x.static {
+			continue
+		}
+		pt, err := p.parse(x.index)
+		if err != nil {
+			t.Errorf("%v: parse %v: %v", x.pattern, x.index, err)
+			continue
+		}
+		if got := p.format(pt); got != x.index {
+			t.Errorf("%v: parse %v got %v", x.pattern, x.index, pt)
+		}
+	}
+}
+
+func TestIndexPatternErrors(t *testing.T) {
+	for _, x := range []string{"events-%", "events-%H", "layout:"} {
+		if _, err := indexPattern(x).parts(); err == nil {
+			t.Errorf("%v: expected error", x)
+		}
+	}
+	p := indexPattern("events-%Y%m%d")
+	for _, x := range []string{"events-2024030", "events-20240305-1", "alerts-20240305", "events-2024x305"} {
+		if _, err := p.parse(x); err == nil {
+			t.Errorf("%v: expected parse error", x)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"sort"
+	"time"
+)
+
+const inspectExampleLen = 60
+
+type fieldStats struct {
+	count   int
+	example string
+}
+
+// Flatten a document into dotted field paths, recording how many documents
+// each field was seen in and an example value
+func flattenFields(prefix string, v interface{}, seen map[string]bool, stats map[string]*fieldStats) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, x := range m {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			flattenFields(name, x, seen, stats)
+		}
+		return
+	}
+	if seen[prefix] {
+		return
+	}
+	seen[prefix] = true
+	st, ok := stats[prefix]
+	if !ok {
+		st = &fieldStats{}
+		stats[prefix] = st
+	}
+	st.count++
+	if st.example == "" && v != nil {
+		buf, err := json.Marshal(v)
+		if err == nil {
+			st.example = string(buf)
+			if len(st.example) > inspectExampleLen {
+				st.example = st.example[:inspectExampleLen] + "..."
+			}
+		}
+	}
+}
+
+// Sample up to count documents from the time window and report the union of
+// fields observed along with their frequency and an example value
+func (cfg *config) runInspect(args []string) error {
+	fs := cfg.newFlagSet("inspect", "", "Sample documents from the time window and report the fields observed, with\ntheir frequency and an example value.")
+	begindate := fs.String("b", "", "start date for search in UTC (yyyy-mm-dd hh:mm:ss, now, or relative such as -24h or -7d)")
+	fs.String("config", defaultConfigPath(), "configuration file")
+	fs.String("profile", "", "use named profile from configuration file")
+	last := fs.String("last", cfg.file.Last, "search the window preceding now (e.g., 4h, 3d), instead of -b and -e")
+	enddate := fs.String("e", "", "end date for search in UTC (yyyy-mm-dd hh:mm:ss, now, or relative, defaults to now)")
+	count := fs.Int("N", 100, "number of documents to sample")
+	doctype := fs.String("type", "", "only sample documents of type")
+	indexpat := fs.String("index-pattern", envDefault("", cfg.file.IndexPattern, defaultIndexPattern),
+		"daily index name pattern, strftime (e.g., events-%Y.%m.%d), a Go layout prefixed with layout:, or a static index or alias name")
+	alias := fs.String("alias", cfg.file.Alias, "search a single index or alias instead of daily indices, overrides -index-pattern")
+	var connopts connOptions
+	connopts.addFlags(fs, cfg.file)
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.configureConn(connopts)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.setIndexPattern(*indexpat, *alias)
+	if err != nil {
+		return err
+	}
+	if *count <= 0 {
+		return fmt.Errorf("-N must be positive")
+	}
+	if *last != "" {
+		err = cfg.parseLast(*last, *begindate, *enddate)
+	} else {
+		err = cfg.parseDates(*begindate, *enddate)
+	}
+	if err != nil {
+		return err
+	}
+	// The sample size bounds the work done, so any range is allowed
+	err = cfg.validateDates(true)
+	if err != nil {
+		return err
+	}
+
+	var qry mozdefevents.Query
+	var qc mozdefevents.Criteria
+	qc.Range = make(map[string]map[string]string)
+	qc.Range["utctimestamp"] = make(map[string]string)
+	qc.Range["utctimestamp"]["gte"] = cfg.startDate.Format(time.RFC3339)
+	qc.Range["utctimestamp"]["lte"] = cfg.endDate.Format(time.RFC3339)
+	qry.Query.Bool.Must = append(qry.Query.Bool.Must, qc)
+	qry.Sort = make(map[string]string)
+	qry.Sort["utctimestamp"] = "asc"
+
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	err = cfg.detectVersion()
+	if err != nil {
+		return err
+	}
+	// Without document types the type is matched in the query instead
+	if *doctype != "" && cfg.esVersion.Typeless() {
+		qry.AddTypeMatch(*doctype, cfg.esVersion)
+	}
+
+	stats := make(map[string]*fieldStats)
+	sampled := 0
+	indices := cfg.indicesForRange(cfg.startDate, cfg.endDate)
+	for i, x := range indices {
+		if sampled >= *count {
+			break
+		}
+		// Spread the sample across the remaining indices
+		qry.Size = (*count - sampled) / (len(indices) - i)
+		if qry.Size == 0 {
+			qry.Size = 1
+		}
+		res, err := conn.SearchPage(cfg.ctx, x, *doctype, qry)
+		if mozdefevents.IsIndexNotFound(err) {
+			skipMissing(x, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, y := range res.Hits.Hits {
+			var doc map[string]interface{}
+			err = json.Unmarshal(y.Source, &doc)
+			if err != nil {
+				return err
+			}
+			flattenFields("", doc, make(map[string]bool), stats)
+			sampled++
+		}
+	}
+	if sampled == 0 {
+		fmt.Fprintf(os.Stderr, "no documents found in window\n")
+		return errNoResults
+	}
+
+	fields := make([]string, 0, len(stats))
+	for k := range stats {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	fmt.Fprintf(os.Stdout, "%v documents sampled\n", sampled)
+	for _, x := range fields {
+		st := stats[x]
+		fmt.Fprintf(os.Stdout, "%-40v %5v %5.1f%% %v\n", x, st.count,
+			float64(st.count)*100/float64(sampled), st.example)
+	}
+	return nil
+}
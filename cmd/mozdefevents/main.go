@@ -0,0 +1,978 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const docsPerSearch int = 100
+
+// Page size and delay between page fetches used in -nice mode
+const (
+	niceDocsPerSearch int = 25
+	nicePageDelay         = time.Second
+)
+
+const (
+	_ = iota
+	MODEAUDIT
+	MODESYSLOG
+	MODEQUERY
+	MODESSH
+	MODESUDO
+	MODEFIREWALL
+	MODEZEEK
+	MODECLOUDTRAIL
+	MODEGUARDDUTY
+	MODEWINDOWS
+	MODEDNS
+	MODEALERTS
+	MODEMFA
+	MODEOSSEC
+	MODEPROXY
+	MODEVPN
+	MODEFAIL2BAN
+)
+
+// config holds the settings and state of a run, it is created by main and
+// passed to the subcommand
+type config struct {
+	eshost         string
+	startDate      time.Time
+	endDate        time.Time
+	mode           int
+	hostmatch      []string
+	rangeflt       *rangeFilter
+	program        string
+	facility       string
+	keyword        string
+	clampStart     bool
+	runid          string
+	runids         []string
+	prevrun        map[string]bool
+	userquery      json.RawMessage
+	hostnocase     bool
+	usePIT         bool
+	filters        []filterSet
+	heatmap        heatmap
+	severity       []string
+	context        time.Duration
+	tags           []string
+	atype          string
+	origuser       string
+	pageSize       int
+	pageDelay      time.Duration
+	requestBudget  int
+	ses            string
+	sessions       *sessionGroups
+	sortField      string
+	sortOrder      string
+	groups         []string
+	tagCounts      tagCounts
+	findings       findingList
+	bruteSources   *bruteSources
+	limit          int
+	collected      int
+	minShouldMatch int
+	dedup          *dedupGroups
+	extraFields    []string
+	alertEvents    bool
+	enrichers      mozdefevents.EnricherChain
+	nestedPath     string
+	output         io.WriteCloser
+	usage          runUsage
+	location       *time.Location
+	follow         *followState
+	tsField        string
+	scheme         string
+	esuser         string
+	espass         string
+	file           fileConfig
+	apikey         string
+	transport      http.RoundTripper
+	conn           *mozdefevents.Client
+	logger         *slog.Logger
+	timing         *timingReport
+	gzip           bool
+	raw            bool
+	esVersion      mozdefevents.Version
+	ctx            context.Context
+	cancel         context.CancelFunc
+	timeout        time.Duration
+	parallel       int
+	indexPattern   indexPattern
+	alias          string
+	remotes        []remoteCluster
+	checkIndices   bool
+	paging         mozdefevents.Paging
+	auditTemplate  *template.Template
+	contextMatches []mozdefevents.Event
+	force          bool
+	tui            *tuiState
+	sink           func([]mozdefevents.Event) error
+	checkpoint     *checkpoint
+	eventFilter    func(mozdefevents.Event) bool
+
+	// Flag sets of the subcommands, collected when generating shell
+	// completions
+	flagSets map[string]*flag.FlagSet
+}
+
+// Returned by a result handler to stop paging once the result limit has
+// been reached
+var errLimitReached = errors.New("result limit reached")
+
+// Returned by a subcommand to set the exit status, for outcomes that are
+// not failures or errors that have already been reported
+var (
+	errNoResults = errors.New("no events matched")
+	errUsage     = errors.New("usage error")
+	errHelp      = errors.New("help requested")
+)
+
+// Exit status of the command, scripts can distinguish a search that matched
+// nothing from one that failed
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitNoResults = 2
+)
+
+// stringList is a flag value that can be specified multiple times, with
+// each occurrence optionally containing a comma separated list
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	for _, x := range strings.Split(v, ",") {
+		x = strings.TrimSpace(x)
+		if x != "" {
+			*s = append(*s, x)
+		}
+	}
+	return nil
+}
+
+// Syslog severities in ascending order
+var severityLevels = []string{"debug", "info", "notice", "warning", "error",
+	"critical", "alert", "emergency"}
+
+// Parse a severity filter, either a single severity or a severity followed
+// by + to include it and everything above it
+func parseSeverity(s string) ([]string, error) {
+	orhigher := strings.HasSuffix(s, "+")
+	s = strings.ToLower(strings.TrimSuffix(s, "+"))
+	for i, x := range severityLevels {
+		if x != s {
+			continue
+		}
+		levels := []string{x}
+		if orhigher {
+			levels = severityLevels[i:]
+		}
+		// Severity is stored uppercase by MozDef but some shippers send it
+		// in lowercase, so match either
+		ret := make([]string, 0)
+		for _, y := range levels {
+			ret = append(ret, y, strings.ToUpper(y))
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unknown severity %q, must be one of %v", s,
+		strings.Join(severityLevels, ", "))
+}
+
+type rangeFilter struct {
+	field string
+	gte   string
+	lte   string
+}
+
+// Parse a numeric range filter in the form field:gte:lte, either bound
+// may be left empty for an open ended range
+func parseRangeFilter(s string) (*rangeFilter, error) {
+	args := strings.Split(s, ":")
+	if len(args) != 3 || args[0] == "" {
+		return nil, errors.New("range filter must be in the form field:gte:lte")
+	}
+	if args[1] == "" && args[2] == "" {
+		return nil, errors.New("range filter must specify at least one bound")
+	}
+	for _, x := range args[1:] {
+		if x == "" {
+			continue
+		}
+		_, err := strconv.ParseFloat(x, 64)
+		if err != nil {
+			return nil, fmt.Errorf("range filter bound %q is not numeric", x)
+		}
+	}
+	return &rangeFilter{field: args[0], gte: args[1], lte: args[2]}, nil
+}
+
+func (cfg *config) defaultSettings(q *mozdefevents.Query) error {
+	q.From = 0
+	q.Size = cfg.pageSize
+	q.Sort = make(map[string]string)
+	q.Sort[cfg.sortField] = cfg.sortOrder
+	if !cfg.raw {
+		q.Source = cfg.sourceFields()
+	}
+
+	var qc mozdefevents.Criteria
+	qc.Range = make(map[string]map[string]string)
+	qc.Range[cfg.tsField] = make(map[string]string)
+	qc.Range[cfg.tsField]["gte"] = cfg.startDate.Format(time.RFC3339)
+	qc.Range[cfg.tsField]["lte"] = cfg.endDate.Format(time.RFC3339)
+	q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+
+	if cfg.rangeflt != nil {
+		qc = mozdefevents.Criteria{}
+		qc.Range = make(map[string]map[string]string)
+		qc.Range[cfg.rangeflt.field] = make(map[string]string)
+		if cfg.rangeflt.gte != "" {
+			qc.Range[cfg.rangeflt.field]["gte"] = cfg.rangeflt.gte
+		}
+		if cfg.rangeflt.lte != "" {
+			qc.Range[cfg.rangeflt.field]["lte"] = cfg.rangeflt.lte
+		}
+		q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+	}
+
+	if cfg.keyword != "" {
+		q.AddMatch("summary", cfg.keyword)
+	}
+
+	if cfg.origuser != "" {
+		clause, err := cfg.matchAnyClause([]string{"details.suser", "details.originaluser"}, cfg.origuser)
+		if err != nil {
+			return err
+		}
+		q.Query.Bool.Filter = append(q.Query.Bool.Filter, clause)
+	}
+
+	for _, x := range cfg.tags {
+		q.AddMatch("tags", x)
+	}
+
+	if len(cfg.groups) > 0 {
+		clause, err := cfg.assetGroupClause(cfg.groups)
+		if err != nil {
+			return err
+		}
+		q.Query.Bool.Filter = append(q.Query.Bool.Filter, clause)
+	}
+
+	if len(cfg.severity) > 0 {
+		qc = mozdefevents.Criteria{}
+		qc.Terms = make(map[string][]string)
+		qc.Terms["severity"] = cfg.severity
+		q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+	}
+
+	for _, x := range cfg.hostmatch {
+		if cfg.hostnocase {
+			x = mozdefevents.CaseInsensitiveRegexp(x)
+		}
+		for _, y := range []string{"hostname", "details.dhost", "details.hostname"} {
+			qc = mozdefevents.Criteria{}
+			qc.QueryString = make(map[string]string)
+			qc.QueryString["query"] = fmt.Sprintf("%v: /%v/", y, x)
+			q.Query.Bool.Should = append(q.Query.Bool.Should, qc)
+		}
+	}
+
+	if cfg.userquery != nil {
+		q.Query.Bool.Filter = append(q.Query.Bool.Filter, cfg.userquery)
+	}
+
+	for _, x := range cfg.filters {
+		q.Query.Bool.Filter = append(q.Query.Bool.Filter, x.Must...)
+		q.Query.Bool.MustNot = append(q.Query.Bool.MustNot, x.MustNot...)
+	}
+
+	// Only set minimum_should_match if there are should clauses, some ES
+	// versions treat it as a requirement even when there are none
+	if len(q.Query.Bool.Should) > 0 {
+		q.Query.Bool.MinShouldMatch = 1
+		if cfg.minShouldMatch > 0 {
+			q.Query.Bool.MinShouldMatch = cfg.minShouldMatch
+		}
+	}
+	return nil
+}
+
+// Build a bool clause requiring at least one of criteria to match, for use
+// as a filter where the top level should clauses are already in use
+func (cfg *config) shouldClause(criteria []mozdefevents.Criteria) (json.RawMessage, error) {
+	nested := make([]mozdefevents.Criteria, 0, len(criteria))
+	for _, x := range criteria {
+		nested = append(nested, mozdefevents.NestCriteria(x, cfg.nestedPath))
+	}
+	return mozdefevents.ShouldClause(nested)
+}
+
+// Build a clause matching any of vals against field
+func (cfg *config) matchValuesClause(field string, vals []string) (json.RawMessage, error) {
+	criteria := make([]mozdefevents.Criteria, 0, len(vals))
+	for _, x := range vals {
+		criteria = append(criteria, mozdefevents.Criteria{Match: map[string]string{field: x}})
+	}
+	return cfg.shouldClause(criteria)
+}
+
+// Build a clause matching val against any of fields
+func (cfg *config) matchAnyClause(fields []string, val string) (json.RawMessage, error) {
+	criteria := make([]mozdefevents.Criteria, 0)
+	for _, x := range fields {
+		var qc mozdefevents.Criteria
+		qc.Match = make(map[string]string)
+		qc.Match[x] = val
+		criteria = append(criteria, qc)
+	}
+	return cfg.shouldClause(criteria)
+}
+
+// Return the fields to request in the document source, only the fields
+// used by the event are requested unless -raw is set. Any dedup key fields
+// or fields read by the mode which may not be modeled by the event are
+// included.
+func (cfg *config) sourceFields() []string {
+	ret := append([]string{}, mozdefevents.SourceFields...)
+	ret = append(ret, cfg.extraFields...)
+	if cfg.dedup != nil {
+		ret = append(ret, cfg.dedup.fields...)
+	}
+	return ret
+}
+
+// Log msg if -v or -vv was given
+func (cfg *config) log(level slog.Level, msg string, args ...interface{}) {
+	if cfg.logger != nil {
+		cfg.logger.Log(cfg.ctx, level, msg, args...)
+	}
+}
+
+// Sleep for d, returning early with an error if the run deadline passes
+func (cfg *config) pause(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-cfg.ctx.Done():
+		return context.Cause(cfg.ctx)
+	}
+}
+
+// Parse a sort specification in the form field:asc|desc, the order
+// defaulting to ascending if not specified
+func parseSort(s string) (string, string, error) {
+	field, order, found := strings.Cut(s, ":")
+	if field == "" {
+		return "", "", errors.New("sort must be in the form field:asc|desc")
+	}
+	if !found {
+		return field, "asc", nil
+	}
+	order = strings.ToLower(order)
+	if order != "asc" && order != "desc" {
+		return "", "", fmt.Errorf("invalid sort order %q, must be asc or desc", order)
+	}
+	return field, order, nil
+}
+
+// Read a newline delimited list of hostname patterns, ignoring blank lines
+// and comments
+func readHostFile(path string) ([]string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0)
+	for _, x := range strings.Split(string(buf), "\n") {
+		x = strings.TrimSpace(x)
+		if x == "" || strings.HasPrefix(x, "#") {
+			continue
+		}
+		ret = append(ret, x)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no hosts found in %v", path)
+	}
+	return ret, nil
+}
+
+// Read a user supplied query from a file. The file can either contain a
+// query clause (e.g., {"bool": {...}}) or a full search body with the
+// clause under the query key; in both cases the clause is returned so it
+// can be added as a filter alongside the generated criteria.
+func readQueryFile(path string) (json.RawMessage, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	err = json.Unmarshal(buf, &body)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if v, ok := body["query"]; ok {
+		return v, nil
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("%v: query is empty", path)
+	}
+	return json.RawMessage(buf), nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: mozdefevents <command> [flags]\n\ncommands:\n")
+	for _, x := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-10v %v\n", x.name, x.desc)
+	}
+	fmt.Fprintf(os.Stderr, "\nuse mozdefevents <command> -h for the flags of a command\n")
+	fmt.Fprintf(os.Stderr, "\nexit status is %v if events matched, %v if the search matched nothing "+
+		"and %v on error\n", exitOK, exitNoResults, exitError)
+}
+
+func main() {
+	cfg := &config{}
+	cfg.usage.start = time.Now()
+	var err error
+	cfg.file, err = loadFileConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitError)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		os.Exit(exitOK)
+	}
+	for _, x := range subcommands {
+		if x.name != name {
+			continue
+		}
+		err = x.run(cfg, os.Args[2:])
+		switch err {
+		case nil, errHelp:
+			os.Exit(exitOK)
+		case errNoResults:
+			os.Exit(exitNoResults)
+		case errUsage:
+			os.Exit(exitError)
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(exitError)
+	}
+	fmt.Fprintf(os.Stderr, "error: unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitError)
+}
+
+func (cfg *config) showResults(results []mozdefevents.Event) error {
+	if cfg.tui != nil {
+		cfg.tui.events = append(cfg.tui.events, results...)
+		return nil
+	}
+	if cfg.heatmap != nil {
+		cfg.heatmap.add(results, cfg.tsField)
+		return nil
+	}
+	if cfg.tagCounts != nil {
+		cfg.tagCounts.add(results)
+		return nil
+	}
+	if cfg.context > 0 {
+		cfg.contextMatches = append(cfg.contextMatches, results...)
+		return nil
+	}
+	if cfg.sessions != nil {
+		cfg.sessions.add(results)
+		return nil
+	}
+	if cfg.dedup != nil {
+		return cfg.dedup.add(results)
+	}
+	return cfg.printResults(results)
+}
+
+func (cfg *config) printResults(results []mozdefevents.Event) error {
+	if cfg.sink != nil {
+		return cfg.sink(results)
+	}
+	if cfg.output != nil {
+		return ndjsonResults(cfg.output, results)
+	}
+	switch cfg.mode {
+	case MODEAUDIT:
+		cfg.auditResults(results)
+	case MODESYSLOG:
+		cfg.syslogResults(results)
+	case MODEQUERY:
+		cfg.queryResults(results)
+	case MODESSH:
+		cfg.sshResults(results)
+	case MODESUDO:
+		cfg.sudoResults(results)
+	case MODEFIREWALL:
+		cfg.firewallResults(results)
+	case MODEZEEK:
+		cfg.zeekResults(results)
+	case MODECLOUDTRAIL:
+		cfg.cloudtrailResults(results)
+	case MODEGUARDDUTY:
+		cfg.guarddutyResults(results)
+	case MODEWINDOWS:
+		cfg.windowsResults(results)
+	case MODEDNS:
+		cfg.dnsResults(results)
+	case MODEALERTS:
+		cfg.alertResults(results)
+	case MODEMFA:
+		cfg.mfaResults(results)
+	case MODEOSSEC:
+		cfg.ossecResults(results)
+	case MODEPROXY:
+		cfg.proxyResults(results)
+	case MODEVPN:
+		cfg.vpnResults(results)
+	case MODEFAIL2BAN:
+		cfg.fail2banResults(results)
+	}
+	return nil
+}
+
+// Default template used to render audit events that have no dedicated
+// formatter, the template is executed against the normalized event
+const defaultAuditTemplate = `[{{if .Category}}{{.Category}}{{else}}audit{{end}}]` +
+	`{{with .Details.User}} user:{{.}}{{end}}` +
+	`{{with .Details.ProcessName}} proc:{{printf "%q" .}}{{end}}` +
+	`{{with .Details.Path}} path:{{printf "%q" .}}{{end}}` +
+	`{{with .Details.AuditKey}} key:{{.}}{{end}}` +
+	`{{with .Summary}} {{.}}{{end}}`
+
+// Return host for display, prefixed with the cluster the event came from
+// if it was returned by a remote cluster
+func displayHost(e mozdefevents.Event, host string) string {
+	if e.Cluster == "" {
+		return host
+	}
+	return e.Cluster + "/" + host
+}
+
+func (cfg *config) auditTemplateString(e mozdefevents.Event) string {
+	var buf strings.Builder
+	err := cfg.auditTemplate.Execute(&buf, e)
+	if err != nil || buf.Len() == 0 {
+		return "unknown audit event"
+	}
+	return buf.String()
+}
+
+func (cfg *config) auditResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		var evstr string
+		switch x.Category {
+		case "execve":
+			evstr = auditExecveString(x)
+		case "write", "chmod", "chown", "attribute":
+			evstr = auditFileString(x)
+		case "avc":
+			evstr = auditAVCString(x)
+		default:
+			evstr = cfg.auditTemplateString(x)
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Hostname), evstr)
+	}
+}
+
+// Return the display string for a command execution audit event
+func auditExecveString(e mozdefevents.Event) string {
+	origuser := "none"
+	if e.Details.OriginalUser != "" {
+		origuser = e.Details.OriginalUser
+	}
+	ret := fmt.Sprintf("[execve] (%v/%v)", origuser, e.Details.User)
+	if e.Details.Command != "" {
+		ret += fmt.Sprintf(" command:%q", e.Details.Command)
+	}
+	if e.Details.DProc != "" {
+		ret += fmt.Sprintf(" proc:%q", e.Details.ProcessName)
+	}
+	if e.Details.Path != "" {
+		ret += fmt.Sprintf(" path:%q", e.Details.Path)
+	}
+	return ret
+}
+
+// Return the display string for a file write, mode, owner or attribute
+// change audit event
+func auditFileString(e mozdefevents.Event) string {
+	origuser := "none"
+	if e.Details.OriginalUser != "" {
+		origuser = e.Details.OriginalUser
+	}
+	ret := fmt.Sprintf("[%v] (%v/%v)", e.Category, origuser, e.Details.User)
+	if e.Details.Path != "" {
+		ret += fmt.Sprintf(" path:%q", e.Details.Path)
+	}
+	if e.Details.Mode != "" {
+		ret += " mode:" + e.Details.Mode
+	}
+	if e.Details.OUID != "" || e.Details.OGID != "" {
+		ret += fmt.Sprintf(" owner:%v:%v", e.Details.OUID, e.Details.OGID)
+	}
+	if e.Details.ProcessName != "" {
+		ret += fmt.Sprintf(" proc:%q", e.Details.ProcessName)
+	}
+	if e.Details.AuditKey != "" {
+		ret += " key:" + e.Details.AuditKey
+	}
+	return ret
+}
+
+// Return the display string for an SELinux AVC denial
+func auditAVCString(e mozdefevents.Event) string {
+	ret := fmt.Sprintf("[avc] denied { %v }", e.Details.Denied)
+	if e.Details.ProcessName != "" {
+		ret += fmt.Sprintf(" proc:%q", e.Details.ProcessName)
+	}
+	if e.Details.Path != "" {
+		ret += fmt.Sprintf(" path:%q", e.Details.Path)
+	}
+	ret += fmt.Sprintf(" scontext:%v tcontext:%v tclass:%v", e.Details.SContext,
+		e.Details.TContext, e.Details.TClass)
+	return ret
+}
+
+func (cfg *config) syslogResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		evstr := "[syslog]"
+		if x.Details.Program != "" {
+			evstr += fmt.Sprintf(" (%v)", x.Details.Program)
+		} else {
+			evstr += " (unknownprogram)"
+		}
+		if x.Summary != "" {
+			evstr += " " + x.Summary
+		} else {
+			evstr += " no summary found in event"
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Details.Hostname), evstr)
+	}
+}
+
+// Show events of any type, which have only the common fields in a known
+// format
+func (cfg *config) queryResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		category := x.Category
+		if category == "" {
+			category = "unknown"
+		}
+		summary := x.Summary
+		if summary == "" {
+			summary = compactRaw(x.Raw)
+		}
+		fmt.Fprintf(os.Stdout, "%v %v [%v] %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Hostname), category, summary)
+	}
+}
+
+// Return the document of an event with no summary as a single line, so an
+// event of a type with no formatter still shows its fields
+func compactRaw(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if len(raw) == 0 || json.Compact(&buf, raw) != nil {
+		return "no summary found in event"
+	}
+	return buf.String()
+}
+
+// Return the indices that cover the time range, for the local cluster and
+// each remote cluster. The indices are ordered by date and each index is
+// searched in full, so events are ordered across days but within a day the
+// events of each cluster are shown in turn rather than interleaved by time.
+func (cfg *config) indicesForRange(start time.Time, end time.Time) []string {
+	clusters := append([]remoteCluster{{pattern: cfg.indexPattern, alias: cfg.alias}}, cfg.remotes...)
+	indices := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, x := range daysForRange(start, end) {
+		for _, y := range clusters {
+			idx := y.index(x)
+			if seen[idx] {
+				continue
+			}
+			seen[idx] = true
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// Return a time on each day covered by the time range
+func daysForRange(start time.Time, end time.Time) []time.Time {
+	days := make([]time.Time, 0)
+	dp := start
+	for {
+		days = append(days, dp)
+		if end.Sub(dp) < time.Duration(time.Hour*24) {
+			days = append(days, end)
+			break
+		}
+		dp = dp.Add(time.Hour * 24)
+	}
+	return days
+}
+
+// Return the indices covering the time range in the order they are
+// searched, newest first for a descending sort on the timestamp so results
+// are ordered across indices
+func (cfg *config) searchOrder() []string {
+	indices := cfg.indicesForRange(cfg.startDate, cfg.endDate)
+	if cfg.sortField == cfg.tsField && cfg.sortOrder == "desc" {
+		for i, j := 0, len(indices)-1; i < j; i, j = i+1, j-1 {
+			indices[i], indices[j] = indices[j], indices[i]
+		}
+	}
+	return indices
+}
+
+func (cfg *config) runQuery(ctx context.Context, qry mozdefevents.Query, doctype string) error {
+	indices := cfg.searchOrder()
+	if cfg.checkIndices {
+		var err error
+		indices, err = cfg.existingIndices(indices)
+		if err != nil {
+			return err
+		}
+	}
+	cfg.log(slog.LevelInfo, "querying indices", "start", cfg.startDate, "end", cfg.endDate,
+		"indices", strings.Join(indices, ","))
+	var err error
+	if cfg.checkpoint != nil {
+		err = cfg.runQueryCheckpoint(ctx, qry, indices, doctype)
+	} else if cfg.parallel > 1 && len(indices) > 1 {
+		err = cfg.runQueryParallel(ctx, qry, indices, doctype)
+	} else {
+		err = cfg.streamEvents(ctx, qry, indices, doctype, cfg.handleResults)
+	}
+	if err == errLimitReached {
+		err = nil
+	}
+	// If interrupted the results collected so far are still shown, and the
+	// interruption returned once they have been
+	if err != nil && !isInterrupted(err) {
+		return err
+	}
+	if isInterrupted(err) {
+		fmt.Fprintf(os.Stderr, "interrupted, showing %v events collected\n", cfg.collected)
+	}
+	var serr error
+	switch {
+	case cfg.context > 0 && isInterrupted(err):
+		// Fetching the context would need further searches
+		serr = cfg.printResults(cfg.contextMatches)
+	case cfg.context > 0:
+		serr = cfg.showContext(ctx, doctype)
+	case cfg.sessions != nil:
+		serr = cfg.sessions.show(cfg)
+	case cfg.dedup != nil:
+		serr = cfg.dedup.show(cfg)
+	}
+	if serr != nil {
+		return serr
+	}
+	return err
+}
+
+// Handle a page of results from the primary search
+func (cfg *config) handleResults(results []mozdefevents.Event) error {
+	show := make([]mozdefevents.Event, 0, len(results))
+	for _, x := range results {
+		if cfg.eventFilter != nil && !cfg.eventFilter(x) {
+			continue
+		}
+		seen, err := cfg.trackRunEvent(x)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+		show = append(show, x)
+	}
+	if cfg.follow != nil {
+		show = cfg.follow.track(show, cfg.tsField)
+	}
+	if cfg.limit > 0 && cfg.collected+len(show) >= cfg.limit {
+		show = show[:cfg.limit-cfg.collected]
+		cfg.collected += len(show)
+		err := cfg.showResults(show)
+		if err != nil {
+			return err
+		}
+		return errLimitReached
+	}
+	cfg.collected += len(show)
+	return cfg.showResults(show)
+}
+
+// Stream the events matching the query in indices to handler as they are
+// fetched, skipping indices that do not exist
+func (cfg *config) streamEvents(ctx context.Context, qry mozdefevents.Query, indices []string, doctype string, handler func([]mozdefevents.Event) error) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	for ev, err := range conn.Events(ctx, indices, doctype, qry) {
+		if err != nil {
+			var ierr *mozdefevents.IndexError
+			if errors.As(err, &ierr) && skipMissing(ierr.Index, ierr.Err) == nil {
+				continue
+			}
+			return err
+		}
+		err = handler([]mozdefevents.Event{ev})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search a single index a page at a time, handling the events of each page
+// as it is fetched
+func (cfg *config) runQueryIndex(ctx context.Context, qry mozdefevents.Query, index string, doctype string, handler func([]mozdefevents.Event) error) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	return conn.Search(ctx, index, doctype, qry, handler)
+}
+
+func (cfg *config) buildAuditSearch() (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("auditd", cfg.esVersion)
+	if cfg.ses != "" {
+		ret.AddMatch("details.ses", cfg.ses)
+	}
+	if cfg.atype != "" {
+		clause, err := cfg.auditTypeClause(cfg.atype)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Build a clause matching audit events of type atype against the category,
+// details.auditkey and details.name fields, including the names and
+// categories normalized to atype
+func (cfg *config) auditTypeClause(atype string) (json.RawMessage, error) {
+	should := make([]mozdefevents.Criteria, 0)
+	for _, x := range []string{"category", "details.auditkey", "details.name"} {
+		var qc mozdefevents.Criteria
+		qc.Match = make(map[string]string)
+		qc.Match[x] = atype
+		should = append(should, qc)
+	}
+	names := make([]string, 0)
+	for k, v := range mozdefevents.AuditCategories {
+		if v == atype {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, x := range names {
+		var qc mozdefevents.Criteria
+		qc.Match = make(map[string]string)
+		qc.Match["details.name"] = x
+		should = append(should, qc)
+		qc.Match = map[string]string{"category": x}
+		should = append(should, qc)
+	}
+	// AVC denials are also recognized from the summary when the audit
+	// plugin does not name them
+	if atype == "avc" {
+		var qc mozdefevents.Criteria
+		qc.Match = map[string]string{"summary": "avc"}
+		should = append(should, qc)
+	}
+	return cfg.shouldClause(should)
+}
+
+func (cfg *config) buildSyslogSearch() (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("category", "syslog")
+	if cfg.program != "" {
+		ret.AddMatch("details.program", cfg.program)
+	}
+	if cfg.facility != "" {
+		ret.AddMatch("details.facility", cfg.facility)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Build a search for events of any type, optionally limited to documents of
+// doctype
+func (cfg *config) buildQuerySearch(doctype string, category string) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	if doctype != "" {
+		ret.AddTypeMatch(doctype, cfg.esVersion)
+	}
+	if category != "" {
+		ret.AddMatch("category", category)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
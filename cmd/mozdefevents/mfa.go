@@ -0,0 +1,141 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strings"
+)
+
+// mfaFilter holds the criteria of the mfa subcommand
+type mfaFilter struct {
+	source      string
+	user        string
+	factor      string
+	integration string
+	failed      bool
+}
+
+// The results of successful MFA authentications
+var mfaSuccessResults = []string{"success", "allow", "allowed"}
+
+// Return true if an MFA result is a successful authentication
+func mfaSuccess(result string) bool {
+	for _, x := range mfaSuccessResults {
+		if strings.EqualFold(result, x) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f mfaFilter) match(e mozdefevents.Event) bool {
+	return !f.failed || !mfaSuccess(e.Details.Result)
+}
+
+func (cfg *config) buildMFASearch(f mfaFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("source", f.source)
+	if f.user != "" {
+		clause, err := cfg.matchAnyClause([]string{"details.username", "details.user"}, f.user)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	if f.factor != "" {
+		ret.AddMatch("details.factor", f.factor)
+	}
+	if f.integration != "" {
+		ret.AddMatch("details.integration", f.integration)
+	}
+	if f.failed {
+		clause, err := cfg.matchValuesClause("details.result", mfaSuccessResults)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.MustNot = append(ret.Query.Bool.MustNot, clause)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show MFA authentications with the result, factor, user, integration and
+// device of each
+func (cfg *config) mfaResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		result := d.Result
+		if result == "" {
+			result = "unknown"
+		}
+		factor := d.Factor
+		if factor == "" {
+			factor = "unknown"
+		}
+		evstr := fmt.Sprintf("[mfa] %v (%v) user:%v", strings.ToLower(result), factor, d.User)
+		if d.Integration != "" {
+			evstr += fmt.Sprintf(" integration:%q", d.Integration)
+		}
+		if d.Device != "" {
+			evstr += fmt.Sprintf(" device:%q", d.Device)
+		}
+		if d.SourceIPAddress != "" {
+			evstr += " from:" + d.SourceIPAddress
+		}
+		host := x.Hostname
+		if host == "" {
+			host = "-"
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+func (cfg *config) runMFA(args []string) error {
+	fs := cfg.newFlagSet("mfa", "", "Search for Duo or other MFA authentication events, showing the result, factor,\n"+
+		"user, integration and device of each.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f mfaFilter
+	fs.StringVar(&f.source, "source", "duo", "match events from MFA event source")
+	fs.StringVar(&f.user, "user", "", "match authentications for user")
+	fs.StringVar(&f.factor, "factor", "", "match authentications using factor (e.g., push, phone_call)")
+	fs.StringVar(&f.integration, "integration", "", "match authentications for integration")
+	fs.BoolVar(&f.failed, "failed", false, "only match failed or denied authentications")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if f.source == "" {
+		return errors.New("-source must be set")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEMFA
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildMFASearch(f)
+	}
+	return cfg.runSearch(so, eo, "mfa", build, "event")
+}
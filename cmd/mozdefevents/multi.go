@@ -0,0 +1,221 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// multiMode is a mode that can be combined with others by the multi
+// subcommand. setup prepares the configuration for the mode as the mode
+// subcommand would with no mode flags given, and returns the search builder.
+type multiMode struct {
+	mode    int
+	doctype string
+	setup   func(c *config) func() (mozdefevents.Query, error)
+}
+
+var multiModes = map[string]multiMode{
+	"audit": {MODEAUDIT, "auditd", func(c *config) func() (mozdefevents.Query, error) {
+		c.auditTemplate = template.Must(template.New("audit").Parse(defaultAuditTemplate))
+		return c.buildAuditSearch
+	}},
+	"syslog": {MODESYSLOG, "event", func(c *config) func() (mozdefevents.Query, error) {
+		return c.buildSyslogSearch
+	}},
+	"ssh": {MODESSH, "event", func(c *config) func() (mozdefevents.Query, error) {
+		var f sshFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildSSHSearch(f) }
+	}},
+	"sudo": {MODESUDO, "event", func(c *config) func() (mozdefevents.Query, error) {
+		var f sudoFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildSudoSearch(f) }
+	}},
+	"firewall": {MODEFIREWALL, "event", func(c *config) func() (mozdefevents.Query, error) {
+		var f firewallFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildFirewallSearch(f) }
+	}},
+	"zeek": {MODEZEEK, "bro", func(c *config) func() (mozdefevents.Query, error) {
+		return func() (mozdefevents.Query, error) { return c.buildZeekSearch(zeekFilter{}) }
+	}},
+	"cloudtrail": {MODECLOUDTRAIL, "cloudtrail", func(c *config) func() (mozdefevents.Query, error) {
+		return func() (mozdefevents.Query, error) { return c.buildCloudTrailSearch(cloudtrailFilter{}) }
+	}},
+	"guardduty": {MODEGUARDDUTY, "event", func(c *config) func() (mozdefevents.Query, error) {
+		c.extraFields = guarddutyFields
+		return func() (mozdefevents.Query, error) { return c.buildGuardDutySearch("", 0) }
+	}},
+	"windows": {MODEWINDOWS, "event", func(c *config) func() (mozdefevents.Query, error) {
+		return func() (mozdefevents.Query, error) { return c.buildWindowsSearch(windowsFilter{}) }
+	}},
+	"dns": {MODEDNS, "", func(c *config) func() (mozdefevents.Query, error) {
+		var f dnsFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildDNSSearch(f) }
+	}},
+	"mfa": {MODEMFA, "event", func(c *config) func() (mozdefevents.Query, error) {
+		f := mfaFilter{source: "duo"}
+		return func() (mozdefevents.Query, error) { return c.buildMFASearch(f) }
+	}},
+	"ossec": {MODEOSSEC, "event", func(c *config) func() (mozdefevents.Query, error) {
+		return func() (mozdefevents.Query, error) { return c.buildOSSECSearch(ossecFilter{}) }
+	}},
+	"proxy": {MODEPROXY, "event", func(c *config) func() (mozdefevents.Query, error) {
+		return func() (mozdefevents.Query, error) { return c.buildProxySearch(proxyFilter{}) }
+	}},
+	"vpn": {MODEVPN, "event", func(c *config) func() (mozdefevents.Query, error) {
+		var f vpnFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildVPNSearch(f) }
+	}},
+	"fail2ban": {MODEFAIL2BAN, "event", func(c *config) func() (mozdefevents.Query, error) {
+		var f fail2banFilter
+		c.eventFilter = f.match
+		return func() (mozdefevents.Query, error) { return c.buildFail2banSearch(f) }
+	}},
+}
+
+// Return the names of the modes that can be combined, in name order
+func multiModeNames() []string {
+	ret := make([]string, 0, len(multiModes))
+	for k := range multiModes {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// multiEvent is an event collected by a multi search, with the
+// configuration of the mode that found it used to show it
+type multiEvent struct {
+	event mozdefevents.Event
+	cfg   *config
+}
+
+func (cfg *config) runMulti(args []string) error {
+	fs := cfg.newFlagSet("multi", "mode...", "Run the searches of several modes over the same time range and criteria, showing\n"+
+		"the events found by all of them in timestamp order in the format of each mode. The\n"+
+		"events of each mode are collected before any are shown, up to -limit events per\n"+
+		"mode. Modes are "+strings.Join(multiModeNames(), ", ")+".")
+	so := cfg.addSearchFlags(fs)
+	limit := fs.Int("limit", 10000, "maximum number of events collected from each mode (0 for no limit)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("multi requires at least one mode")
+	}
+	if *limit < 0 {
+		return errors.New("-limit must not be negative")
+	}
+	names := make([]string, 0, fs.NArg())
+	seen := make(map[string]bool)
+	for _, x := range fs.Args() {
+		if _, ok := multiModes[x]; !ok {
+			return fmt.Errorf("unknown mode %q, must be one of %v", x, strings.Join(multiModeNames(), ", "))
+		}
+		if !seen[x] {
+			names = append(names, x)
+			seen[x] = true
+		}
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = so.connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	events := make([]multiEvent, 0)
+	for _, x := range names {
+		m := multiModes[x]
+		c := *cfg
+		mc := &c
+		mc.mode = m.mode
+		mc.limit = *limit
+		mc.collected = 0
+		build := m.setup(mc)
+		qry, err := build()
+		if err != nil {
+			return fmt.Errorf("%v: %v", x, err)
+		}
+		reqs := noopRequests{endpoint: "_search", indices: mc.searchOrder()}
+		if *so.noop {
+			fmt.Fprintf(os.Stdout, "%v:\n", x)
+		}
+		if done, err := so.printQuery(mc, qry, m.doctype, reqs); done {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		mc.sink = func(results []mozdefevents.Event) error {
+			for _, y := range results {
+				events = append(events, multiEvent{event: y, cfg: mc})
+			}
+			return nil
+		}
+		err = mc.runQuery(cfg.ctx, qry, m.doctype)
+		mc.sink = nil
+		if err != nil && !isInterrupted(err) {
+			return fmt.Errorf("%v: %v", x, err)
+		}
+		if *limit > 0 && mc.collected >= *limit {
+			fmt.Fprintf(os.Stderr, "notice: %v search reached limit of %v events\n", x, *limit)
+		}
+		cfg.collected += mc.collected
+		if err != nil {
+			serr := cfg.showMulti(events)
+			if serr != nil {
+				return serr
+			}
+			return err
+		}
+	}
+	if *so.noop {
+		return nil
+	}
+	err = cfg.showMulti(events)
+	if err != nil {
+		return err
+	}
+	err = so.finish(cfg, "multi")
+	if err != nil {
+		return err
+	}
+	return cfg.matched()
+}
+
+// Show the events collected from each mode ordered by timestamp, events with
+// the same timestamp remain in the order of the modes given
+func (cfg *config) showMulti(events []multiEvent) error {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].event.Time(cfg.tsField).Before(events[j].event.Time(cfg.tsField))
+	})
+	for _, x := range events {
+		err := x.cfg.printResults([]mozdefevents.Event{x.event})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// noopRequests describes the requests a search makes, for -n
+type noopRequests struct {
+	endpoint string
+	indices  []string
+
+	// Set if a single request is made across all the indices, skipping
+	// any that do not exist
+	combined bool
+}
+
+// Print the doctype and the request made against each index, and with curl
+// set an equivalent curl command for each request. The cluster version is
+// not detected with -n, so the typed request paths are shown unless the
+// backend is OpenSearch.
+func (cfg *config) printRequests(w io.Writer, qry mozdefevents.Query, doctype string, reqs noopRequests, curl bool) error {
+	conn, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	switch {
+	case doctype == "":
+		fmt.Fprintf(w, "doctype: none\n")
+	case cfg.esVersion.Typeless():
+		fmt.Fprintf(w, "doctype: %v, matched on the type field\n", doctype)
+	default:
+		fmt.Fprintf(w, "doctype: %v, in the request path (assuming a cluster before ES 7)\n", doctype)
+	}
+
+	var body interface{} = qry
+	if reqs.endpoint == "_count" {
+		body = struct {
+			Query interface{} `json:"query"`
+		}{qry.Query}
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	params := url.Values{}
+	if reqs.combined {
+		params.Set("ignore_unavailable", "true")
+	} else if reqs.endpoint == "_search" && cfg.paging == mozdefevents.PagingScroll {
+		params.Set("scroll", "1m")
+	}
+	if reqs.endpoint == "_search" && !reqs.combined && (cfg.usePIT || cfg.paging == mozdefevents.PagingSearchAfter) {
+		fmt.Fprintf(w, "note: a point in time is opened on each index, the search is then made against /_search with its id\n")
+	}
+
+	indices := reqs.indices
+	if reqs.combined {
+		indices = []string{strings.Join(indices, ",")}
+	}
+	base := cfg.esAddresses()[0]
+	fmt.Fprintf(w, "requests:\n")
+	for _, x := range indices {
+		u := base + conn.RequestPath(x, doctype, reqs.endpoint)
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+		fmt.Fprintf(w, "  POST %v\n", u)
+		if curl {
+			fmt.Fprintf(w, "    %v\n", cfg.curlCommand(u, buf))
+		}
+	}
+	return nil
+}
+
+// Return a curl command making a POST request with body to u. Secrets are
+// not included, curl prompts for the basic authentication password and the
+// API key is read from the environment.
+func (cfg *config) curlCommand(u string, body []byte) string {
+	args := []string{"curl", "-s", "-X", "POST", shellQuote(u), "-H", shellQuote("Content-Type: application/json")}
+	if cfg.esuser != "" {
+		args = append(args, "-u", shellQuote(cfg.esuser))
+	}
+	if cfg.apikey != "" {
+		args = append(args, "-H", `"Authorization: ApiKey $MOZDEFESAPIKEY"`)
+	}
+	args = append(args, "-d", shellQuote(string(body)))
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,136 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// The sources of OSSEC and Wazuh alerts forwarded into MozDef
+var ossecSources = []string{"ossec", "wazuh"}
+
+// ossecFilter holds the criteria of the ossec subcommand, which are matched
+// by the search
+type ossecFilter struct {
+	rules    []string
+	minlevel int
+	maxlevel int
+}
+
+func (cfg *config) buildOSSECSearch(f ossecFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	clause, err := cfg.matchValuesClause("source", ossecSources)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if len(f.rules) > 0 {
+		clause, err = cfg.matchValuesClause("details.rule.id", f.rules)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	if f.minlevel > 0 || f.maxlevel > 0 {
+		var qc mozdefevents.Criteria
+		bounds := make(map[string]string)
+		if f.minlevel > 0 {
+			bounds["gte"] = strconv.Itoa(f.minlevel)
+		}
+		if f.maxlevel > 0 {
+			bounds["lte"] = strconv.Itoa(f.maxlevel)
+		}
+		qc.Range = map[string]map[string]string{"details.rule.level": bounds}
+		ret.Query.Bool.Must = append(ret.Query.Bool.Must, qc)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show OSSEC alerts with the rule, level and description, followed by the
+// decoded fields in name order
+func (cfg *config) ossecResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		var rule mozdefevents.HIDSRule
+		if x.Details.Rule != nil {
+			rule = *x.Details.Rule
+		}
+		id := string(rule.ID)
+		if id == "" {
+			id = "unknown"
+		}
+		desc := rule.Description
+		if desc == "" {
+			desc = x.Summary
+		}
+		evstr := fmt.Sprintf("[ossec] rule:%v level:%v %q", id, rule.Level, desc)
+		names := make([]string, 0, len(x.Details.Decoded))
+		for k := range x.Details.Decoded {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			evstr += fmt.Sprintf(" %v=%v", k, x.Details.Decoded[k])
+		}
+		host := x.Hostname
+		if host == "" {
+			host = x.Details.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+func (cfg *config) runOSSEC(args []string) error {
+	fs := cfg.newFlagSet("ossec", "", "Search for OSSEC and Wazuh alerts, showing the rule, level, description and\n"+
+		"decoded fields of each.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	rules := fs.String("rule", "", "match alerts for rule id, or any of a comma separated list")
+	var f ossecFilter
+	fs.IntVar(&f.minlevel, "level", 0, "match alerts of at least level")
+	fs.IntVar(&f.maxlevel, "maxlevel", 0, "match alerts of at most level")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if f.minlevel < 0 || f.maxlevel < 0 {
+		return errors.New("-level and -maxlevel must not be negative")
+	}
+	if f.maxlevel > 0 && f.minlevel > f.maxlevel {
+		return errors.New("-level cannot be greater than -maxlevel")
+	}
+	f.rules, err = parseIDs(*rules)
+	if err != nil {
+		return err
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEOSSEC
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildOSSECSearch(f)
+	}
+	return cfg.runSearch(so, eo, "ossec", build, "event")
+}
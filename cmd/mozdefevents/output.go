@@ -0,0 +1,54 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// Open an output destination for NDJSON results. The destination is either
+// unix:/path to connect to a listening unix domain socket, or fifo:/path to
+// write to a named pipe.
+func openOutput(dest string) (io.WriteCloser, error) {
+	scheme, path, found := strings.Cut(dest, ":")
+	if !found || path == "" {
+		return nil, fmt.Errorf("invalid output %q, must be unix:/path or fifo:/path", dest)
+	}
+	switch scheme {
+	case "unix":
+		return net.Dial("unix", path)
+	case "fifo":
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			return nil, fmt.Errorf("%v is not a named pipe", path)
+		}
+		return os.OpenFile(path, os.O_WRONLY, 0)
+	}
+	return nil, fmt.Errorf("unknown output type %q, must be unix or fifo", scheme)
+}
+
+// Write results as newline delimited JSON
+func ndjsonResults(w io.Writer, results []mozdefevents.Event) error {
+	enc := json.NewEncoder(w)
+	for _, x := range results {
+		err := enc.Encode(x)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
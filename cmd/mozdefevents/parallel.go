@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"github.com/ameihm0912/mozdefevents"
+)
+
+// Number of pages a worker can fetch ahead of the pages being handled
+const parallelPageBuffer = 8
+
+// indexPages carries the pages fetched from an index by a worker, pages is
+// closed once the index has been fully fetched and err set
+type indexPages struct {
+	index string
+	pages chan []mozdefevents.Event
+	err   error
+}
+
+// Query the indices using up to cfg.parallel concurrent workers. The pages
+// are handled in index order so the results remain ordered as they would be
+// with sequential querying, while workers on later indices fetch ahead.
+func (cfg *config) runQueryParallel(pctx context.Context, qry mozdefevents.Query, indices []string, doctype string) error {
+	// Create the shared client before the workers start
+	_, err := cfg.newConn()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(pctx)
+	defer cancel()
+
+	results := make([]*indexPages, len(indices))
+	for i, x := range indices {
+		results[i] = &indexPages{index: x, pages: make(chan []mozdefevents.Event, parallelPageBuffer)}
+	}
+	// Workers are started in index order, so the earliest index not yet
+	// handled always holds a slot and the pages are always drained
+	sem := make(chan struct{}, cfg.parallel)
+	go func() {
+		for i, r := range results {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				for _, x := range results[i:] {
+					x.err = context.Cause(ctx)
+					close(x.pages)
+				}
+				return
+			}
+			go func(r *indexPages) {
+				handler := func(ev []mozdefevents.Event) error {
+					select {
+					case r.pages <- ev:
+						return nil
+					case <-ctx.Done():
+						return context.Cause(ctx)
+					}
+				}
+				r.err = skipMissing(r.index, cfg.runQueryIndex(ctx, qry, r.index, doctype, handler))
+				close(r.pages)
+				<-sem
+			}(r)
+		}
+	}()
+
+	for _, r := range results {
+		for x := range r.pages {
+			err = cfg.handleResults(x)
+			if err != nil {
+				return err
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
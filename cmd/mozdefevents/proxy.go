@@ -0,0 +1,161 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// proxyFilter selects the requests shown by the proxy subcommand
+type proxyFilter struct {
+	url    *regexp.Regexp
+	method string
+	status string
+	user   string
+	client string
+}
+
+// Return the URL of a proxy request, either the destination recorded by the
+// proxy or the host and URI
+func proxyURL(d mozdefevents.EventDetails) string {
+	if d.Destination != "" {
+		return d.Destination
+	}
+	return d.Host + d.URI
+}
+
+// Return the status of a proxy request
+func proxyStatus(d mozdefevents.EventDetails) string {
+	if d.Status != "" {
+		return string(d.Status)
+	}
+	return string(d.StatusCode)
+}
+
+func (f proxyFilter) match(e mozdefevents.Event) bool {
+	return f.url == nil || f.url.MatchString(proxyURL(e.Details))
+}
+
+// Build a search for proxy requests, the URL regexp is matched against the
+// returned requests by proxyFilter
+func (cfg *config) buildProxySearch(f proxyFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	should := []mozdefevents.Criteria{
+		{Match: map[string]string{"category": "proxy"}},
+		{Match: map[string]string{"source": "squid"}},
+	}
+	clause, err := cfg.shouldClause(should)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if f.method != "" {
+		ret.AddMatch("details.method", f.method)
+	}
+	if f.status != "" {
+		clause, err = cfg.matchAnyClause([]string{"details.status", "details.status_code"}, f.status)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	if f.user != "" {
+		ret.AddMatch("details.user", f.user)
+	}
+	if f.client != "" {
+		ret.AddMatch("details.sourceipaddress", f.client)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show proxy requests with the client, user, method, status, size and URL
+// of each
+func (cfg *config) proxyResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		client := d.SourceIPAddress
+		if client == "" {
+			client = "unknown"
+		}
+		user := d.User
+		if user == "" {
+			user = "-"
+		}
+		method := d.Method
+		if method == "" {
+			method = "-"
+		}
+		status := proxyStatus(d)
+		if status == "" {
+			status = "-"
+		}
+		evstr := fmt.Sprintf("[proxy] client:%v user:%v %v %v", client, user, strings.ToUpper(method), status)
+		if d.ResponseSize != "" {
+			evstr += fmt.Sprintf(" bytes:%v", d.ResponseSize)
+		}
+		evstr += fmt.Sprintf(" %q", proxyURL(d))
+		if d.ProxyAction != "" {
+			evstr += " action:" + d.ProxyAction
+		}
+		host := x.Hostname
+		if host == "" {
+			host = d.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+func (cfg *config) runProxy(args []string) error {
+	fs := cfg.newFlagSet("proxy", "", "Search for web proxy access events such as squid logs, showing the client, user,\n"+
+		"method, status, size and URL of each request. -url is matched against each request\n"+
+		"returned by the search.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	url := fs.String("url", "", "match requests for URLs matching regexp")
+	var f proxyFilter
+	fs.StringVar(&f.method, "method", "", "match requests with method (e.g., GET, CONNECT)")
+	fs.StringVar(&f.status, "status", "", "match requests with response status")
+	fs.StringVar(&f.user, "user", "", "match requests by proxy user")
+	fs.StringVar(&f.client, "client", "", "match requests from client address")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *url != "" {
+		f.url, err = regexp.Compile(*url)
+		if err != nil {
+			return fmt.Errorf("-url: %v", err)
+		}
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEPROXY
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildProxySearch(f)
+	}
+	return cfg.runSearch(so, eo, "proxy", build, "event")
+}
@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ameihm0912/mozdefevents"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEvents = `
+{"type":"event","utctimestamp":"2024-03-05T01:00:00Z","hostname":"web1.prod.example.com","category":"syslog","summary":"Accepted publickey for alice from 192.0.2.1 port 50000 ssh2","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T02:00:00Z","hostname":"WEB2.prod.example.com","category":"syslog","summary":"Failed password for bob from 192.0.2.2 port 50001 ssh2","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T03:00:00Z","hostname":"ci7.example.com","category":"syslog","summary":"Failed password for root from 192.0.2.3 port 50002 ssh2","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T04:00:00Z","category":"dns","details":{"hostname":"ns1.example.com","query":"www.Evil.example.","sourceipaddress":"192.0.2.4"}}
+{"type":"event","utctimestamp":"2024-03-05T05:00:00Z","category":"dns","details":{"hostname":"ns1.example.com","query":"notevil.example.","sourceipaddress":"192.0.2.5"}}
+{"type":"event","utctimestamp":"2024-03-05T06:00:00Z","hostname":"fw1.example.com","category":"firewall","summary":"connection accepted","details":{"sourceipaddress":"198.51.100.7","destinationipaddress":"203.0.113.9","destinationport":"443","proto":"tcp","action":"accept"}}
+{"type":"event","utctimestamp":"2024-03-05T07:00:00Z","hostname":"fw2.example.com","category":"firewall","summary":"connection dropped","details":{"sourceipaddress":"203.0.113.9","destinationipaddress":"198.51.100.7","destinationport":"22","proto":"tcp","action":"drop"}}
+{"type":"cloudtrail","utctimestamp":"2024-03-05T08:00:00Z","hostname":"ct-ok","details":{"eventname":"ConsoleLogin"}}
+{"type":"cloudtrail","utctimestamp":"2024-03-05T09:00:00Z","hostname":"ct-denied","details":{"eventname":"ConsoleLogin","errorcode":"AccessDenied"}}
+{"type":"event","utctimestamp":"2024-03-05T10:00:00Z","hostname":"duo-ok","source":"duo","details":{"result":"SUCCESS","user":"alice"}}
+{"type":"event","utctimestamp":"2024-03-05T11:00:00Z","hostname":"duo-denied","source":"duo","details":{"result":"DENIED","user":"alice"}}
+{"type":"event","utctimestamp":"2024-03-07T01:00:00Z","hostname":"web1.prod.example.com","category":"syslog","summary":"Failed password for carol from 192.0.2.6 port 50003 ssh2","details":{"program":"sshd"}}
+`
+
+func newTestConfig() *config {
+	return &config{
+		pageSize:  100,
+		sortField: "utctimestamp",
+		sortOrder: "asc",
+		tsField:   "utctimestamp",
+		startDate: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		endDate:   time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC),
+		esVersion: mozdefevents.Version{Major: 7},
+	}
+}
+
+// Run a built query through a mock backend holding testEvents, returning
+// the hostname of each matching event
+func searchMock(t *testing.T, q mozdefevents.Query) []string {
+	t.Helper()
+	m := mozdefevents.NewMockBackend()
+	err := m.LoadNDJSON("events-20240305", strings.NewReader(testEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := mozdefevents.NewClient(nil, mozdefevents.WithBackend(m),
+		mozdefevents.WithVersion(mozdefevents.Version{Major: 7}), mozdefevents.WithoutReconcile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make([]string, 0)
+	for e, err := range c.Events(context.Background(), []string{"events-20240305"}, "event", q) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		host := e.Hostname
+		if host == "" {
+			host = e.Details.Hostname + " " + e.Details.Query
+		}
+		ret = append(ret, host)
+	}
+	return ret
+}
+
+func TestQueryBuilders(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cfg *config)
+		build func(cfg *config) (mozdefevents.Query, error)
+		want  []string
+	}{
+		{
+			"ssh failed",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildSSHSearch(sshFilter{failed: true})
+			},
+			[]string{"WEB2.prod.example.com", "ci7.example.com"},
+		},
+		{
+			"ssh hostmatch",
+			func(cfg *config) {
+				cfg.hostmatch = []string{`web[0-9]+\..*`}
+			},
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildSSHSearch(sshFilter{})
+			},
+			[]string{"web1.prod.example.com"},
+		},
+		{
+			"ssh hostmatch ignoring case",
+			func(cfg *config) {
+				cfg.hostmatch = []string{`web[0-9]+\..*`}
+				cfg.hostnocase = true
+			},
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildSSHSearch(sshFilter{})
+			},
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com"},
+		},
+		{
+			"syslog filters",
+			func(cfg *config) {
+				cfg.filters = []filterSet{{
+					MustNot: []json.RawMessage{json.RawMessage(`{"query_string":{"query":"hostname: /ci[0-9]+\\..*/"}}`)},
+				}}
+			},
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildSyslogSearch()
+			},
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com"},
+		},
+		{
+			"dns domain",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildDNSSearch(dnsFilter{domain: `(.*\.)?evil\.example`})
+			},
+			[]string{"ns1.example.com www.Evil.example."},
+		},
+		{
+			"dns",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildDNSSearch(dnsFilter{})
+			},
+			[]string{"ns1.example.com www.Evil.example.", "ns1.example.com notevil.example."},
+		},
+		{
+			"firewall source structured only",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildFirewallSearch(firewallFilter{source: "198.51.100.7"})
+			},
+			[]string{"fw1.example.com"},
+		},
+		{
+			"firewall destination structured only",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildFirewallSearch(firewallFilter{dest: "198.51.100.7"})
+			},
+			[]string{"fw2.example.com"},
+		},
+		{
+			"cloudtrail errors",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildCloudTrailSearch(cloudtrailFilter{failed: true})
+			},
+			[]string{"ct-denied"},
+		},
+		{
+			"mfa failed",
+			nil,
+			func(cfg *config) (mozdefevents.Query, error) {
+				return cfg.buildMFASearch(mfaFilter{source: "duo", failed: true})
+			},
+			[]string{"duo-denied"},
+		},
+	}
+	for _, x := range tests {
+		cfg := newTestConfig()
+		if x.setup != nil {
+			x.setup(cfg)
+		}
+		q, err := x.build(cfg)
+		if err != nil {
+			t.Fatalf("%v: %v", x.name, err)
+		}
+		got := searchMock(t, q)
+		if strings.Join(got, ",") != strings.Join(x.want, ",") {
+			t.Errorf("%v: got %v, want %v", x.name, got, x.want)
+		}
+	}
+}
+
+func TestDNSFilterKeepsEventsWithoutQuery(t *testing.T) {
+	var e mozdefevents.Event
+	e.Details.SourceIPAddress = "192.0.2.4"
+	if !(dnsFilter{}).match(e) || !(dnsFilter{client: "192.0.2.4"}).match(e) {
+		t.Errorf("event without a query name was dropped")
+	}
+	if (dnsFilter{qtype: "A"}).match(e) {
+		t.Errorf("event without a query type matched -qtype")
+	}
+}
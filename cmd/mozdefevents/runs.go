@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stored runs are kept as a list of document IDs, one per line, so a later
+// run can be compared against them and only report new events
+func runStorePath(runid string) (string, error) {
+	if runid == "" || strings.ContainsAny(runid, "/\\") || runid == "." || runid == ".." {
+		return "", fmt.Errorf("invalid run id %q", runid)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mozdefevents", "runs", runid), nil
+}
+
+func loadRun(runid string) (map[string]bool, error) {
+	path, err := runStorePath(runid)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no stored run with id %q", runid)
+		}
+		return nil, err
+	}
+	defer fd.Close()
+	ret := make(map[string]bool)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" {
+			ret[id] = true
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func saveRun(runid string, ids []string) error {
+	path, err := runStorePath(runid)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmppath := path + ".tmp"
+	fd, err := os.OpenFile(tmppath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fd)
+	for _, x := range ids {
+		fmt.Fprintf(w, "%v\n", x)
+	}
+	err = w.Flush()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	err = fd.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmppath, path)
+}
+
+// Returns true if the event was present in the run we are diffing against,
+// and records the event ID if the current run is being stored
+func (cfg *config) trackRunEvent(e mozdefevents.Event) (bool, error) {
+	if e.ID == "" && (cfg.runid != "" || cfg.prevrun != nil) {
+		return false, errors.New("event has no document id, cannot track run")
+	}
+	if cfg.runid != "" {
+		cfg.runids = append(cfg.runids, e.ID)
+	}
+	if cfg.prevrun != nil && cfg.prevrun[e.ID] {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Subcommands that can be saved, the searches and inspect
+var savedCommands = map[string]bool{
+	"audit":      true,
+	"syslog":     true,
+	"ssh":        true,
+	"sudo":       true,
+	"firewall":   true,
+	"zeek":       true,
+	"cloudtrail": true,
+	"guardduty":  true,
+	"windows":    true,
+	"dns":        true,
+	"alerts":     true,
+	"mfa":        true,
+	"ossec":      true,
+	"proxy":      true,
+	"vpn":        true,
+	"fail2ban":   true,
+	"query":      true,
+	"count":      true,
+	"top":        true,
+	"inspect":    true,
+}
+
+// savedSearch is a subcommand and its flags stored under a name. The flags
+// are stored as given, so a relative window such as -last 7d is evaluated
+// each time the search is run.
+type savedSearch struct {
+	Command     string    `json:"command"`
+	Args        []string  `json:"args"`
+	Description string    `json:"description,omitempty"`
+	Saved       time.Time `json:"saved"`
+}
+
+func savedSearchPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mozdefevents", "saved.json"), nil
+}
+
+func loadSavedSearches() (map[string]savedSearch, error) {
+	path, err := savedSearchPath()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]savedSearch)
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(buf, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return ret, nil
+}
+
+func writeSavedSearches(saved map[string]savedSearch) error {
+	path, err := savedSearchPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(saved, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmppath := path + ".tmp"
+	err = os.WriteFile(tmppath, append(buf, '\n'), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmppath, path)
+}
+
+// Check the flags of a search to be saved parse for its subcommand, so a
+// mistake is reported when saving rather than when the search is run
+func (cfg *config) validateSaved(command string, args []string) error {
+	if !savedCommands[command] {
+		return fmt.Errorf("cannot save %q, must be one of audit, syslog, ssh, sudo, firewall, zeek, cloudtrail, guardduty, windows, dns, alerts, mfa, ossec, proxy, vpn, fail2ban, query, count, top or inspect", command)
+	}
+	c := &config{file: cfg.file, flagSets: make(map[string]*flag.FlagSet)}
+	for _, x := range subcommands {
+		if x.name == command {
+			x.run(c, nil)
+		}
+	}
+	fs := c.flagSets[command]
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%v: %v", command, err)
+	}
+	return nil
+}
+
+// Return the arguments of the saved search for display, quoting any
+// containing spaces
+func (s savedSearch) commandLine() string {
+	ret := []string{s.Command}
+	for _, x := range s.Args {
+		if x == "" || strings.ContainsAny(x, " \t'\"") {
+			x = shellQuote(x)
+		}
+		ret = append(ret, x)
+	}
+	return strings.Join(ret, " ")
+}
+
+func (cfg *config) savedSave(args []string) error {
+	fs := cfg.newFlagSet("saved save", "name command [flags]", "Save a search under name, for example:\n\n"+
+		"    mozdefevents saved save -d \"weekly sudo review\" sudo-review audit -H bastion -last 7d\n\n"+
+		"Relative windows given with -last or relative -b and -e are evaluated when the search is run.")
+	desc := fs.String("d", "", "description of the saved search")
+	force := fs.Bool("f", false, "replace an existing saved search with the same name")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	name := fs.Arg(0)
+	if name == "" || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid saved search name %q", name)
+	}
+	s := savedSearch{
+		Command:     fs.Arg(1),
+		Args:        fs.Args()[2:],
+		Description: *desc,
+		Saved:       time.Now().UTC(),
+	}
+	err = cfg.validateSaved(s.Command, s.Args)
+	if err != nil {
+		return err
+	}
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return err
+	}
+	if _, ok := saved[name]; ok && !*force {
+		return fmt.Errorf("saved search %q exists, use -f to replace it", name)
+	}
+	saved[name] = s
+	return writeSavedSearches(saved)
+}
+
+func (cfg *config) savedList(args []string) error {
+	fs := cfg.newFlagSet("saved list", "", "List the saved searches.")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(saved))
+	for k := range saved {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, x := range names {
+		s := saved[x]
+		fmt.Fprintf(os.Stdout, "%-20v %v\n", x, s.commandLine())
+		if s.Description != "" {
+			fmt.Fprintf(os.Stdout, "%-20v %v\n", "", s.Description)
+		}
+	}
+	return nil
+}
+
+func (cfg *config) savedDelete(args []string) error {
+	fs := cfg.newFlagSet("saved delete", "name", "Delete a saved search.")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return err
+	}
+	if _, ok := saved[fs.Arg(0)]; !ok {
+		return fmt.Errorf("no saved search %q", fs.Arg(0))
+	}
+	delete(saved, fs.Arg(0))
+	return writeSavedSearches(saved)
+}
+
+// Run a saved search, any flags given after the name are added after the
+// saved flags so they take precedence
+func (cfg *config) savedRun(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "usage: mozdefevents saved run name [flags]\n\n"+
+			"Run a saved search, flags given after the name are added to the saved flags.\n")
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			return errHelp
+		}
+		return errUsage
+	}
+	saved, err := loadSavedSearches()
+	if err != nil {
+		return err
+	}
+	s, ok := saved[args[0]]
+	if !ok {
+		return fmt.Errorf("no saved search %q", args[0])
+	}
+	runargs := append(append([]string{}, s.Args...), args[1:]...)
+	// The configuration file and profile can be selected by the saved flags
+	cfg.file, err = loadFileConfig(runargs)
+	if err != nil {
+		return err
+	}
+	for _, x := range subcommands {
+		if x.name == s.Command {
+			return x.run(cfg, runargs)
+		}
+	}
+	return fmt.Errorf("saved search %q has unknown command %q", args[0], s.Command)
+}
+
+func (cfg *config) runSaved(args []string) error {
+	actions := map[string]func(*config, []string) error{
+		"save":   (*config).savedSave,
+		"list":   (*config).savedList,
+		"run":    (*config).savedRun,
+		"delete": (*config).savedDelete,
+	}
+	if cfg.flagSets != nil {
+		// Only the actions have flags, the completions cover the actions
+		return cfg.parseFlags(cfg.newFlagSet("saved", "", ""), args)
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: mozdefevents saved save|list|run|delete [flags]\n\n"+
+			"Manage searches saved under a name, use mozdefevents saved <action> -h for the flags of an action.\n")
+		return errUsage
+	}
+	f, ok := actions[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown saved search action %q, must be save, list, run or delete", args[0])
+	}
+	return f(cfg, args[1:])
+}
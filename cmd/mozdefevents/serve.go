@@ -0,0 +1,469 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Largest request body accepted by the server
+const maxSearchRequest = 1 << 20
+
+// Time given to searches in progress to complete when the server stops
+const serveStopDelay = 30 * time.Second
+
+// searchRequest is the body of a POST /search request, and the search of an
+// exporter metric. The fields correspond to the flags of the search
+// subcommands.
+//
+//	{"type": "audit", "last": "4h", "hosts": ["^bastion"], "atype": "execve"}
+type searchRequest struct {
+	Type       string   `json:"type" yaml:"type"`
+	Begin      string   `json:"begin" yaml:"begin"`
+	End        string   `json:"end" yaml:"end"`
+	Last       string   `json:"last" yaml:"last"`
+	Hosts      []string `json:"hosts" yaml:"hosts"`
+	HostNoCase bool     `json:"hostnocase" yaml:"hostnocase"`
+	Keyword    string   `json:"keyword" yaml:"keyword"`
+	Tags       []string `json:"tags" yaml:"tags"`
+	Groups     []string `json:"groups" yaml:"groups"`
+	Severity   string   `json:"severity" yaml:"severity"`
+	OrigUser   string   `json:"origuser" yaml:"origuser"`
+	Range      string   `json:"range" yaml:"range"`
+	Filters    []string `json:"filters" yaml:"filters"`
+	Sort       string   `json:"sort" yaml:"sort"`
+	Limit      int      `json:"limit" yaml:"limit"`
+
+	// Audit searches
+	AuditType string `json:"atype" yaml:"atype"`
+	Session   string `json:"ses" yaml:"ses"`
+
+	// Syslog searches
+	Program  string `json:"program" yaml:"program"`
+	Facility string `json:"facility" yaml:"facility"`
+
+	// Searches of any type
+	DocType  string `json:"doctype" yaml:"doctype"`
+	Category string `json:"category" yaml:"category"`
+}
+
+// searchServer serves searches over HTTP, each request is run with a copy
+// of the server configuration sharing its client
+type searchServer struct {
+	base       *config
+	filterfile string
+	maxLimit   int
+	deadline   time.Duration
+	logger     *slog.Logger
+}
+
+// flushWriter writes results to the response as they are fetched
+type flushWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.wrote = true
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
+
+func (f *flushWriter) Close() error {
+	return nil
+}
+
+// Write a JSON error response
+func writeSearchError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// Return a copy of the configuration for a search request, with the
+// function to build its query and the doctype searched
+func (cfg *config) requestConfig(req searchRequest, filterfile string) (*config, func() (mozdefevents.Query, error), string, error) {
+	c := *cfg
+	cfg = &c
+	var err error
+	if req.Last != "" {
+		err = cfg.parseLast(req.Last, req.Begin, req.End)
+	} else {
+		if req.Begin == "" {
+			return nil, nil, "", errors.New("one of begin or last is required")
+		}
+		err = cfg.parseDates(req.Begin, req.End)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	err = cfg.validateDates(cfg.force)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cfg.hostmatch = req.Hosts
+	cfg.hostnocase = req.HostNoCase
+	cfg.keyword = req.Keyword
+	cfg.tags = req.Tags
+	cfg.groups = req.Groups
+	cfg.origuser = req.OrigUser
+	if req.Severity != "" {
+		cfg.severity, err = parseSeverity(req.Severity)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if req.Range != "" {
+		cfg.rangeflt, err = parseRangeFilter(req.Range)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if len(req.Filters) > 0 {
+		cfg.filters, err = resolveFilters(filterfile, req.Filters)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if req.Sort != "" {
+		cfg.sortField, cfg.sortOrder, err = parseSort(req.Sort)
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+	if req.Limit < 0 {
+		return nil, nil, "", errors.New("limit must not be negative")
+	}
+	cfg.limit = req.Limit
+	switch req.Type {
+	case "audit":
+		cfg.mode = MODEAUDIT
+		cfg.atype = strings.ToLower(req.AuditType)
+		cfg.ses = req.Session
+		return cfg, cfg.buildAuditSearch, "auditd", nil
+	case "syslog":
+		cfg.mode = MODESYSLOG
+		cfg.program = req.Program
+		cfg.facility = req.Facility
+		return cfg, cfg.buildSyslogSearch, "event", nil
+	case "", "query":
+		cfg.mode = MODEQUERY
+		build := func() (mozdefevents.Query, error) {
+			return cfg.buildQuerySearch(req.DocType, req.Category)
+		}
+		return cfg, build, req.DocType, nil
+	}
+	return nil, nil, "", fmt.Errorf("unknown type %q, must be audit, syslog or query", req.Type)
+}
+
+// Run a search, streaming the matching events as NDJSON. An error once
+// events have been written is reported as a final {"error": ...} line, as
+// the status has already been sent.
+func (s *searchServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req searchRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSearchRequest))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&req)
+	if err != nil {
+		writeSearchError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %v", err))
+		return
+	}
+	cfg, build, doctype, err := s.base.requestConfig(req, s.filterfile)
+	if err != nil {
+		writeSearchError(w, http.StatusBadRequest, err)
+		return
+	}
+	if s.maxLimit > 0 && (cfg.limit == 0 || cfg.limit > s.maxLimit) {
+		cfg.limit = s.maxLimit
+	}
+	qry, err := build()
+	if err != nil {
+		writeSearchError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := r.Context()
+	if s.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, s.deadline, errDeadline)
+		defer cancel()
+	}
+	cfg.ctx = ctx
+	out := &flushWriter{w: w}
+	cfg.output = out
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	err = cfg.runQuery(ctx, qry, doctype)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		s.logger.Error("search failed", "remote", r.RemoteAddr, "type", req.Type, "events", cfg.collected,
+			"elapsed", elapsed, "error", err)
+		if !out.wrote {
+			writeSearchError(w, http.StatusBadGateway, err)
+			return
+		}
+		json.NewEncoder(out).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	s.logger.Info("search", "remote", r.RemoteAddr, "type", req.Type, "start", cfg.startDate, "end", cfg.endDate,
+		"events", cfg.collected, "elapsed", elapsed)
+}
+
+// serverOptions are the flags shared by the subcommands running a server
+// which searches on behalf of its clients
+type serverOptions struct {
+	connopts   connOptions
+	listen     *string
+	tz         *string
+	force      *bool
+	indexpat   *string
+	alias      *string
+	remotes    stringList
+	filterfile *string
+	tsfield    *string
+	parallel   *int
+	tlscert    *string
+	tlskey     *string
+	clientca   *string
+
+	deadline  time.Duration
+	token     string
+	tlsConfig *tls.Config
+}
+
+func (cfg *config) addServerFlags(fs *flag.FlagSet, listen string) *serverOptions {
+	o := &serverOptions{}
+	fs.String("config", defaultConfigPath(), "configuration file")
+	fs.String("profile", "", "use named profile from configuration file")
+	o.connopts.addFlags(fs, cfg.file)
+	o.listen = fs.String("listen", listen, "address to listen on, other than loopback requires -tls-cert "+
+		"and either -client-ca or a token")
+	o.tlscert = fs.String("tls-cert", "", "certificate to serve TLS with")
+	o.tlskey = fs.String("tls-key", "", "key for the -tls-cert certificate")
+	o.clientca = fs.String("client-ca", "", "require client certificates signed by a CA in bundle, requires -tls-cert")
+	o.token = envDefault("MOZDEFSERVETOKEN")
+	o.tz = fs.String("tz", "", "time zone for dates in searches (e.g., America/Los_Angeles, defaults to TZ or UTC)")
+	o.force = fs.Bool("force", false, "allow searches over very large time ranges")
+	o.indexpat = fs.String("index-pattern", envDefault("", cfg.file.IndexPattern, defaultIndexPattern),
+		"daily index name pattern, strftime (e.g., events-%Y.%m.%d), a Go layout prefixed with layout:, or a static index or alias name")
+	o.alias = fs.String("alias", cfg.file.Alias, "search a single index or alias instead of daily indices, overrides -index-pattern")
+	fs.Var(&o.remotes, "remote", "also search remote cluster configured for cross cluster search (repeatable), each day is shown a cluster at a time")
+	o.filterfile = fs.String("filterfile", defaultFilterPath(), "path to named filter definitions")
+	o.tsfield = fs.String("tsfield", "utctimestamp", "timestamp field used for the time range and sort (utctimestamp or receivedtimestamp)")
+	o.parallel = fs.Int("parallel", 1, "number of daily indices to query concurrently for each search")
+	return o
+}
+
+// Return true if the listen address only accepts local connections
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Set up the TLS configuration and bearer token clients authenticate with.
+// Clients are authenticated with a certificate if -client-ca is given, or
+// the token from MOZDEFSERVETOKEN if set. The events a server can search are
+// only exposed beyond the local host over TLS to authenticated clients.
+func (o *serverOptions) configureAuth() error {
+	if (*o.tlscert == "") != (*o.tlskey == "") {
+		return errors.New("-tls-cert and -tls-key must be specified together")
+	}
+	if *o.clientca != "" && *o.tlscert == "" {
+		return errors.New("-client-ca requires -tls-cert")
+	}
+	if !loopbackAddr(*o.listen) && (*o.tlscert == "" || (*o.clientca == "" && o.token == "")) {
+		return errors.New("listening on an address other than loopback requires -tls-cert, " +
+			"and -client-ca or a token set in MOZDEFSERVETOKEN")
+	}
+	if *o.tlscert == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(*o.tlscert, *o.tlskey)
+	if err != nil {
+		return err
+	}
+	o.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if *o.clientca != "" {
+		buf, err := os.ReadFile(*o.clientca)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("%v: no certificates found", *o.clientca)
+		}
+		o.tlsConfig.ClientCAs = pool
+		o.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// Return true if the value of an Authorization header carries the bearer
+// token, or no token is required
+func (o *serverOptions) authorized(header string) bool {
+	if o.token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+o.token)) == 1
+}
+
+// Wrap handler to reject requests without the bearer token
+func (o *serverOptions) requireToken(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !o.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeSearchError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Apply the server flags to the configuration, creating the client and
+// detecting the version once so it is shared by the searches
+func (o *serverOptions) apply(cfg *config) error {
+	err := o.configureAuth()
+	if err != nil {
+		return err
+	}
+	// The deadline applies to each search rather than the server
+	o.deadline = o.connopts.deadline
+	o.connopts.deadline = 0
+	err = cfg.configureConn(o.connopts)
+	if err != nil {
+		return err
+	}
+	cfg.location, err = loadLocation(*o.tz)
+	if err != nil {
+		return err
+	}
+	cfg.force = *o.force
+	err = cfg.setIndexPattern(*o.indexpat, *o.alias)
+	if err != nil {
+		return err
+	}
+	remotes := o.remotes
+	if len(remotes) == 0 {
+		remotes = cfg.file.Remotes
+	}
+	err = cfg.setRemotes(remotes)
+	if err != nil {
+		return err
+	}
+	if *o.tsfield != "utctimestamp" && *o.tsfield != "receivedtimestamp" {
+		return errors.New("-tsfield must be utctimestamp or receivedtimestamp")
+	}
+	cfg.tsField = *o.tsfield
+	cfg.sortField = cfg.tsField
+	cfg.sortOrder = "asc"
+	if *o.parallel < 1 {
+		return errors.New("-parallel must be at least 1")
+	}
+	cfg.parallel = *o.parallel
+	cfg.pageSize = docsPerSearch
+	cfg.paging = mozdefevents.PagingFrom
+	return cfg.detectVersion()
+}
+
+// Serve handler on the listen address until interrupted, giving requests in
+// progress time to complete
+func (o *serverOptions) serve(ctx context.Context, handler http.Handler, logger *slog.Logger) error {
+	srv := &http.Server{
+		Addr:              *o.listen,
+		Handler:           o.requireToken(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         o.tlsConfig,
+	}
+	errch := make(chan error, 1)
+	go func() {
+		if o.tlsConfig != nil {
+			errch <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errch <- srv.ListenAndServe()
+	}()
+	logger.Info("listening", "address", *o.listen)
+	select {
+	case err := <-errch:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("server stopping, waiting for requests in progress")
+	sctx, cancel := context.WithTimeout(context.Background(), serveStopDelay)
+	defer cancel()
+	return srv.Shutdown(sctx)
+}
+
+// Serve searches over HTTP until interrupted
+func (cfg *config) runServe(args []string) error {
+	fs := cfg.newFlagSet("serve", "", "Serve searches over HTTP for services that need event access without a direct ES connection.\n\n"+
+		"POST /search with a JSON body selecting the events, for example:\n\n"+
+		"    {\"type\": \"audit\", \"last\": \"4h\", \"hosts\": [\"^bastion\"], \"atype\": \"execve\"}\n\n"+
+		"type is audit, syslog or query, and the time range is given by begin and end or last.\n"+
+		"The criteria are hosts, hostnocase, keyword, tags, groups, severity, origuser, range,\n"+
+		"filters, atype and ses for audit, program and facility for syslog, and doctype and\n"+
+		"category for query, with sort and limit, as for the flags of the subcommands. Matching\n"+
+		"events are streamed as NDJSON, an error once events have been sent is given as a final\n"+
+		"error line.\n\n"+
+		"If MOZDEFSERVETOKEN is set, requests must carry it in an Authorization: Bearer header.")
+	vo := cfg.addServerFlags(fs, "localhost:8080")
+	maxLimit := fs.Int("max-events", 0, "maximum number of events returned by a search (0 for no limit)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *maxLimit < 0 {
+		return errors.New("-max-events must not be negative")
+	}
+	err = vo.apply(cfg)
+	if err != nil {
+		return err
+	}
+	s := &searchServer{
+		base:       cfg,
+		filterfile: *vo.filterfile,
+		maxLimit:   *maxLimit,
+		deadline:   vo.deadline,
+		logger:     slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /search", s.handleSearch)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return vo.serve(ctx, mux, s.logger)
+}
@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"localhost:8080", true},
+		{"127.0.0.1:8080", true},
+		{"[::1]:8080", true},
+		{":8080", false},
+		{"0.0.0.0:8080", false},
+		{"192.0.2.1:8080", false},
+		{"events.example.com:8080", false},
+	}
+	for _, x := range tests {
+		if got := loopbackAddr(x.addr); got != x.want {
+			t.Errorf("%v: got %v, want %v", x.addr, got, x.want)
+		}
+	}
+}
+
+func newServerOptions(listen string, token string) *serverOptions {
+	empty := ""
+	return &serverOptions{listen: &listen, tlscert: &empty, tlskey: &empty, clientca: &empty, token: token}
+}
+
+func TestServerAuthRequired(t *testing.T) {
+	for _, x := range []struct {
+		listen string
+		token  string
+	}{
+		{":8080", ""},
+		{":8080", "secret"},
+	} {
+		if err := newServerOptions(x.listen, x.token).configureAuth(); err == nil {
+			t.Errorf("%v with token %q: expected error without TLS", x.listen, x.token)
+		}
+	}
+	if err := newServerOptions("localhost:8080", "").configureAuth(); err != nil {
+		t.Errorf("loopback without authentication: %v", err)
+	}
+}
+
+func TestServerToken(t *testing.T) {
+	o := newServerOptions("localhost:8080", "secret")
+	h := o.requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for _, x := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusNoContent},
+	} {
+		r := httptest.NewRequest("POST", "/search", nil)
+		if x.header != "" {
+			r.Header.Set("Authorization", x.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != x.want {
+			t.Errorf("%q: got status %v, want %v", x.header, w.Code, x.want)
+		}
+	}
+}
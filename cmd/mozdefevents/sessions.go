@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+)
+
+type sessionKey struct {
+	host string
+	ses  string
+}
+
+// sessionGroups collects events by host and audit session, retaining the
+// order in which each session was first seen
+type sessionGroups struct {
+	order  []sessionKey
+	events map[sessionKey][]mozdefevents.Event
+}
+
+func newSessionGroups() *sessionGroups {
+	return &sessionGroups{events: make(map[sessionKey][]mozdefevents.Event)}
+}
+
+func (s *sessionGroups) add(results []mozdefevents.Event) {
+	for _, x := range results {
+		key := sessionKey{host: x.Hostname, ses: x.Details.Ses}
+		if key.ses == "" {
+			key.ses = "unknown"
+		}
+		if _, ok := s.events[key]; !ok {
+			s.order = append(s.order, key)
+		}
+		s.events[key] = append(s.events[key], x)
+	}
+}
+
+func (s *sessionGroups) show(cfg *config) error {
+	for i, x := range s.order {
+		if i > 0 {
+			fmt.Fprintf(os.Stdout, "\n")
+		}
+		evs := s.events[x]
+		fmt.Fprintf(os.Stdout, "== %v session %v (%v events, %v to %v)\n", x.host,
+			x.ses, len(evs), cfg.displayTime(evs[0].Timestamp),
+			cfg.displayTime(evs[len(evs)-1].Timestamp))
+		err := cfg.printResults(evs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// Return a context cancelled with errInterrupted on the first SIGINT. The
+// handler is removed once the context is done, so a second SIGINT kills the
+// process if flushing the results collected so far hangs.
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+	go func() {
+		select {
+		case <-ch:
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// Return true if err is the result of the run being interrupted, in which
+// case the results collected so far should still be shown
+func isInterrupted(err error) bool {
+	return errors.Is(err, errInterrupted)
+}
@@ -0,0 +1,78 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"io"
+	"net/http"
+	"time"
+)
+
+// sigv4Transport signs each request with AWS SigV4 for Amazon OpenSearch
+// Service domains protected by IAM
+type sigv4Transport struct {
+	creds  aws.CredentialsProvider
+	region string
+	signer *v4.Signer
+	next   http.RoundTripper
+}
+
+// Create a signing transport using the standard AWS credential chain
+// (environment, shared config and credentials files, instance roles)
+func newSigV4Transport(region string, next http.RoundTripper) (*sigv4Transport, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awscfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if awscfg.Region == "" {
+		return nil, errors.New("AWS region not set, use -aws-region or AWS_REGION")
+	}
+	return &sigv4Transport{
+		creds:  awscfg.Credentials,
+		region: awscfg.Region,
+		signer: v4.NewSigner(),
+		next:   next,
+	}, nil
+}
+
+func (t *sigv4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	hash := sha256.Sum256(body)
+	creds, err := t.creds.Retrieve(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	err = t.signer.SignHTTP(req.Context(), creds, req, hex.EncodeToString(hash[:]),
+		"es", t.region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,178 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"regexp"
+)
+
+// sshAuth is an authentication attempt parsed from the summary of an sshd
+// syslog event
+type sshAuth struct {
+	Success bool
+	Method  string
+	User    string
+	Invalid bool
+	Source  string
+	Port    string
+}
+
+// The sshd messages for authentication attempts, the summary may still
+// carry the sshd[pid] prefix depending on how the event was ingested
+var (
+	sshAcceptedRe = regexp.MustCompile(`^(?:\S+\[\d+\]: )?Accepted (\S+) for (\S+) from (\S+) port (\d+)`)
+	sshFailedRe   = regexp.MustCompile(`^(?:\S+\[\d+\]: )?Failed (\S+) for (invalid user )?(\S*) from (\S+) port (\d+)`)
+	sshInvalidRe  = regexp.MustCompile(`^(?:\S+\[\d+\]: )?Invalid user (\S*) from (\S+)(?: port (\d+))?`)
+)
+
+// Parse an sshd summary, returning false if it is not an authentication
+// attempt
+func parseSSHAuth(summary string) (sshAuth, bool) {
+	if m := sshAcceptedRe.FindStringSubmatch(summary); m != nil {
+		return sshAuth{Success: true, Method: m[1], User: m[2], Source: m[3], Port: m[4]}, true
+	}
+	if m := sshFailedRe.FindStringSubmatch(summary); m != nil {
+		return sshAuth{Method: m[1], Invalid: m[2] != "", User: m[3], Source: m[4], Port: m[5]}, true
+	}
+	if m := sshInvalidRe.FindStringSubmatch(summary); m != nil {
+		return sshAuth{Method: "none", Invalid: true, User: m[1], Source: m[2], Port: m[3]}, true
+	}
+	return sshAuth{}, false
+}
+
+// sshFilter selects the authentication attempts shown by the ssh subcommand
+type sshFilter struct {
+	user     string
+	source   string
+	method   string
+	failed   bool
+	accepted bool
+}
+
+func (f sshFilter) match(e mozdefevents.Event) bool {
+	a, ok := parseSSHAuth(e.Summary)
+	if !ok {
+		return false
+	}
+	switch {
+	case f.user != "" && a.User != f.user:
+		return false
+	case f.source != "" && a.Source != f.source:
+		return false
+	case f.method != "" && a.Method != f.method:
+		return false
+	case f.failed && a.Success:
+		return false
+	case f.accepted && !a.Success:
+		return false
+	}
+	return true
+}
+
+// Build a search for sshd authentication messages, the summary criteria
+// narrow the search and the attempts are then matched exactly by sshFilter
+func (cfg *config) buildSSHSearch(f sshFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("category", "syslog")
+	ret.AddMatch("details.program", "sshd")
+	words := []string{"Accepted", "Failed", "Invalid"}
+	switch {
+	case f.accepted:
+		words = words[:1]
+	case f.failed:
+		words = words[1:]
+	}
+	should := make([]mozdefevents.Criteria, 0, len(words))
+	for _, x := range words {
+		var qc mozdefevents.Criteria
+		qc.Match = map[string]string{"summary": x}
+		should = append(should, qc)
+	}
+	clause, err := cfg.shouldClause(should)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if f.user != "" {
+		ret.AddMatch("summary", f.user)
+	}
+	if f.source != "" {
+		ret.AddMatch("summary", f.source)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show ssh authentication attempts, other sshd events such as those shown
+// with -context are shown as syslog events
+func (cfg *config) sshResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		a, ok := parseSSHAuth(x.Summary)
+		if !ok {
+			cfg.syslogResults([]mozdefevents.Event{x})
+			continue
+		}
+		result := "failed"
+		if a.Success {
+			result = "accepted"
+		}
+		user := a.User
+		if a.Invalid {
+			user = "invalid:" + user
+		}
+		evstr := fmt.Sprintf("[ssh] %v (%v) user:%v from:%v", result, a.Method, user, a.Source)
+		if a.Port != "" {
+			evstr += " port:" + a.Port
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Details.Hostname), evstr)
+	}
+}
+
+func (cfg *config) runSSH(args []string) error {
+	fs := cfg.newFlagSet("ssh", "", "Search for sshd authentication attempts, showing the result, method, user and source of each.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f sshFilter
+	fs.StringVar(&f.user, "user", "", "match attempts for user")
+	fs.StringVar(&f.source, "from", "", "match attempts from source address")
+	fs.StringVar(&f.method, "method", "", "match attempts using method (e.g., publickey, password)")
+	fs.BoolVar(&f.failed, "failed", false, "only match failed attempts")
+	fs.BoolVar(&f.accepted, "accepted", false, "only match accepted attempts")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if f.failed && f.accepted {
+		return errors.New("-failed and -accepted cannot be combined")
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODESSH
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildSSHSearch(f)
+	}
+	return cfg.runSearch(so, eo, "ssh", build, "event")
+}
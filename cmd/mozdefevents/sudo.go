@@ -0,0 +1,171 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// sudoCommand is a command run with sudo, parsed from the summary of a sudo
+// syslog event such as
+//
+//	alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/bin/ls -la
+//
+// A command sudo refused has the reason before the fields, for example
+// "3 incorrect password attempts" or "user NOT in sudoers".
+type sudoCommand struct {
+	User    string
+	RunAs   string
+	TTY     string
+	PWD     string
+	Command string
+	Failure string
+}
+
+var sudoPrefixRe = regexp.MustCompile(`^sudo(?:\[\d+\])?: `)
+
+// Parse a sudo summary, returning false if it does not record a command
+func parseSudoCommand(summary string) (sudoCommand, bool) {
+	var ret sudoCommand
+	summary = strings.TrimSpace(sudoPrefixRe.ReplaceAllString(summary, ""))
+	user, rest, found := strings.Cut(summary, " : ")
+	if !found || strings.ContainsAny(user, " \t") {
+		return ret, false
+	}
+	ret.User = user
+	// COMMAND is always last and can itself contain " ; "
+	rest, command, found := strings.Cut(rest, "COMMAND=")
+	if !found {
+		return ret, false
+	}
+	ret.Command = command
+	for _, x := range strings.Split(strings.TrimSuffix(rest, " ; "), " ; ") {
+		k, v, found := strings.Cut(x, "=")
+		if !found {
+			ret.Failure = strings.TrimSpace(x)
+			continue
+		}
+		switch k {
+		case "TTY":
+			ret.TTY = v
+		case "PWD":
+			ret.PWD = v
+		case "USER":
+			ret.RunAs = v
+		}
+	}
+	return ret, true
+}
+
+// sudoFilter selects the commands shown by the sudo subcommand
+type sudoFilter struct {
+	user    string
+	runas   string
+	command string
+	failed  bool
+}
+
+func (f sudoFilter) match(e mozdefevents.Event) bool {
+	c, ok := parseSudoCommand(e.Summary)
+	if !ok {
+		return false
+	}
+	switch {
+	case f.user != "" && c.User != f.user:
+		return false
+	case f.runas != "" && c.RunAs != f.runas:
+		return false
+	case f.command != "" && !strings.Contains(c.Command, f.command):
+		return false
+	case f.failed && c.Failure == "":
+		return false
+	}
+	return true
+}
+
+// Build a search for sudo command messages, the commands are then matched
+// exactly by sudoFilter
+func (cfg *config) buildSudoSearch(f sudoFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("category", "syslog")
+	ret.AddMatch("details.program", "sudo")
+	ret.AddMatch("summary", "COMMAND")
+	if f.user != "" {
+		ret.AddMatch("summary", f.user)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show sudo commands in the form of the execve formatter, other sudo events
+// such as those shown with -context are shown as syslog events
+func (cfg *config) sudoResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		c, ok := parseSudoCommand(x.Summary)
+		if !ok {
+			cfg.syslogResults([]mozdefevents.Event{x})
+			continue
+		}
+		runas := c.RunAs
+		if runas == "" {
+			runas = "root"
+		}
+		evstr := fmt.Sprintf("[sudo] (%v/%v) command:%q", c.User, runas, c.Command)
+		if c.TTY != "" {
+			evstr += fmt.Sprintf(" tty:%v", c.TTY)
+		}
+		if c.PWD != "" {
+			evstr += fmt.Sprintf(" pwd:%q", c.PWD)
+		}
+		if c.Failure != "" {
+			evstr += fmt.Sprintf(" failed:%q", c.Failure)
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Details.Hostname), evstr)
+	}
+}
+
+func (cfg *config) runSudo(args []string) error {
+	fs := cfg.newFlagSet("sudo", "", "Search for commands run with sudo, showing the invoking and target users, tty,\n"+
+		"working directory and command of each. Useful on hosts without auditd.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f sudoFilter
+	fs.StringVar(&f.user, "user", "", "match commands run by invoking user")
+	fs.StringVar(&f.runas, "runas", "", "match commands run as target user")
+	fs.StringVar(&f.command, "command", "", "match commands containing string")
+	fs.BoolVar(&f.failed, "failed", false, "only match commands sudo refused")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODESUDO
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildSudoSearch(f)
+	}
+	return cfg.runSearch(so, eo, "sudo", build, "event")
+}
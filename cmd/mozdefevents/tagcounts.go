@@ -0,0 +1,63 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"sort"
+)
+
+// Fields that identify the asset group of the host an event came from
+var assetGroupFields = []string{"tags", "details.asset_group"}
+
+// Build a clause matching events belonging to any of the asset groups
+func (cfg *config) assetGroupClause(groups []string) (json.RawMessage, error) {
+	criteria := make([]mozdefevents.Criteria, 0)
+	for _, x := range groups {
+		for _, y := range assetGroupFields {
+			var qc mozdefevents.Criteria
+			qc.Match = make(map[string]string)
+			qc.Match[y] = x
+			criteria = append(criteria, qc)
+		}
+	}
+	return cfg.shouldClause(criteria)
+}
+
+// tagCounts counts events per tag and asset group
+type tagCounts map[string]int
+
+func (t tagCounts) add(results []mozdefevents.Event) {
+	for _, x := range results {
+		for _, y := range x.Tags {
+			t[y]++
+		}
+		if x.Details.AssetGroup != "" {
+			t["asset_group:"+x.Details.AssetGroup]++
+		}
+	}
+}
+
+func (t tagCounts) render(w io.Writer) {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if t[keys[i]] == t[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return t[keys[i]] > t[keys[j]]
+	})
+	for _, x := range keys {
+		fmt.Fprintf(w, "%8v %v\n", t[x], x)
+	}
+}
@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// indexTiming records the search requests made against an index
+type indexTiming struct {
+	pages     int
+	documents int
+	bytes     int
+	latency   time.Duration
+	slowest   time.Duration
+}
+
+func (t *indexTiming) addPage(latency time.Duration, documents int, bytes int) {
+	t.pages++
+	t.documents += documents
+	t.bytes += bytes
+	t.latency += latency
+	if latency > t.slowest {
+		t.slowest = latency
+	}
+}
+
+// timingReport collects the timing for each index searched, indices that
+// are searched more than once such as in follow mode are accumulated
+type timingReport struct {
+	sync.Mutex
+	order   []string
+	indices map[string]*indexTiming
+}
+
+func newTimingReport() *timingReport {
+	return &timingReport{indices: make(map[string]*indexTiming)}
+}
+
+// Add a page fetched from index, the report may be nil if timing is disabled
+func (r *timingReport) addPage(index string, latency time.Duration, documents int, bytes int) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	cur, ok := r.indices[index]
+	if !ok {
+		cur = &indexTiming{}
+		r.indices[index] = cur
+		r.order = append(r.order, index)
+	}
+	cur.addPage(latency, documents, bytes)
+}
+
+func (r *timingReport) render(w io.Writer) {
+	r.Lock()
+	defer r.Unlock()
+	var total indexTiming
+	fmt.Fprintf(w, "%-30v %6v %10v %12v %12v %12v\n", "index", "pages",
+		"documents", "bytes", "latency", "slowest")
+	for _, x := range r.order {
+		t := r.indices[x]
+		fmt.Fprintf(w, "%-30v %6v %10v %12v %12v %12v\n", x, t.pages, t.documents,
+			t.bytes, t.latency.Round(time.Millisecond), t.slowest.Round(time.Millisecond))
+		total.pages += t.pages
+		total.documents += t.documents
+		total.bytes += t.bytes
+		total.latency += t.latency
+		if t.slowest > total.slowest {
+			total.slowest = t.slowest
+		}
+	}
+	fmt.Fprintf(w, "%-30v %6v %10v %12v %12v %12v\n", "total", total.pages, total.documents,
+		total.bytes, total.latency.Round(time.Millisecond), total.slowest.Round(time.Millisecond))
+}
@@ -0,0 +1,370 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"time"
+)
+
+// Keys read from the terminal that are not a single rune
+const (
+	keyEsc rune = iota + 0x110000
+	keyUp
+	keyDown
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+)
+
+const tuiHelp = "j/k move  tab detail  / filter  [ ] shift range  - + zoom  r search again  q quit"
+
+// tuiState is the state of the interactive result browser. Events are
+// collected by showResults while a search runs, and visible holds the
+// indices of the events matching the filter.
+type tuiState struct {
+	events    []mozdefevents.Event
+	haystack  []string
+	visible   []int
+	sel       int
+	top       int
+	filter    string
+	filtering bool
+	detail    bool
+	scroll    int
+	status    string
+}
+
+// Apply the filter, matching the lower cased filter against the summary,
+// host, category and raw document of each event
+func (t *tuiState) applyFilter() {
+	for i := len(t.haystack); i < len(t.events); i++ {
+		x := t.events[i]
+		t.haystack = append(t.haystack, strings.ToLower(strings.Join([]string{x.Summary,
+			x.Hostname, x.Category, string(x.Raw)}, "\n")))
+	}
+	f := strings.ToLower(t.filter)
+	t.visible = t.visible[:0]
+	for i, x := range t.haystack {
+		if f == "" || strings.Contains(x, f) {
+			t.visible = append(t.visible, i)
+		}
+	}
+	if t.sel >= len(t.visible) {
+		t.sel = len(t.visible) - 1
+	}
+	if t.sel < 0 {
+		t.sel = 0
+	}
+	t.scroll = 0
+}
+
+// Move the selection by n events, keeping it on the list
+func (t *tuiState) move(n int) {
+	t.sel += n
+	if t.sel >= len(t.visible) {
+		t.sel = len(t.visible) - 1
+	}
+	if t.sel < 0 {
+		t.sel = 0
+	}
+	t.scroll = 0
+}
+
+// Return the detail lines for the selected event, the normalized event
+// followed by the raw document
+func (t *tuiState) detailLines() []string {
+	if len(t.visible) == 0 {
+		return nil
+	}
+	e := t.events[t.visible[t.sel]]
+	ret := []string{"normalized:"}
+	buf, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		buf = []byte(err.Error())
+	}
+	ret = append(ret, strings.Split(string(buf), "\n")...)
+	ret = append(ret, "", "raw:")
+	var raw bytes.Buffer
+	if json.Indent(&raw, e.Raw, "", "  ") != nil {
+		raw.Reset()
+		raw.Write(e.Raw)
+	}
+	return append(ret, strings.Split(raw.String(), "\n")...)
+}
+
+// Return s fitted to width columns, with control characters replaced so a
+// line cannot break the layout
+func tuiLine(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+	return runewidth.Truncate(s, width, "…")
+}
+
+// Draw the screen, a header, the event list, the detail pane for the
+// selected event and a status line
+func (cfg *config) tuiRender(w *bufio.Writer) {
+	t := cfg.tui
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 8 {
+		width, height = 80, 24
+	}
+	listh := (height - 3) / 2
+	detailh := height - 3 - listh
+	if t.sel < t.top {
+		t.top = t.sel
+	}
+	if t.sel >= t.top+listh {
+		t.top = t.sel - listh + 1
+	}
+
+	lines := make([]string, 0, height)
+	header := fmt.Sprintf(" %v - %v  %v events", cfg.displayTime(cfg.startDate).Format(time.RFC3339),
+		cfg.displayTime(cfg.endDate).Format(time.RFC3339), len(t.events))
+	if t.filter != "" {
+		header += fmt.Sprintf(", %v matching %q", len(t.visible), t.filter)
+	}
+	lines = append(lines, "\x1b[7m"+runewidth.FillRight(tuiLine(header, width), width)+"\x1b[0m")
+	for i := t.top; i < t.top+listh; i++ {
+		if i >= len(t.visible) {
+			lines = append(lines, "")
+			continue
+		}
+		x := t.events[t.visible[i]]
+		category := x.Category
+		if category == "" {
+			category = "unknown"
+		}
+		line := tuiLine(fmt.Sprintf("%v %v [%v] %v", cfg.displayTime(x.Timestamp).Format(time.RFC3339),
+			displayHost(x, x.Hostname), category, x.Summary), width)
+		if i == t.sel {
+			line = "\x1b[7m" + runewidth.FillRight(line, width) + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	sep := "── detail "
+	if t.detail {
+		sep = "── detail (j/k scroll, tab to return) "
+	}
+	lines = append(lines, tuiLine(sep+strings.Repeat("─", width), width))
+	detail := t.detailLines()
+	if t.scroll > len(detail)-detailh {
+		t.scroll = max(len(detail)-detailh, 0)
+	}
+	for i := t.scroll; i < t.scroll+detailh; i++ {
+		if i < len(detail) {
+			lines = append(lines, tuiLine(detail[i], width))
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	status := tuiHelp
+	switch {
+	case t.filtering:
+		status = "/" + t.filter
+	case t.status != "":
+		status = t.status
+	}
+	lines = append(lines, tuiLine(status, width))
+
+	w.WriteString("\x1b[H")
+	for i, x := range lines {
+		w.WriteString(x + "\x1b[K")
+		if i < len(lines)-1 {
+			w.WriteString("\r\n")
+		}
+	}
+	w.Flush()
+}
+
+// Read a key, decoding the escape sequences for the cursor and paging keys.
+// A lone escape is returned as keyEsc.
+func readKey(rd *bufio.Reader) (rune, error) {
+	r, _, err := rd.ReadRune()
+	if err != nil || r != 0x1b {
+		return r, err
+	}
+	if rd.Buffered() == 0 {
+		return keyEsc, nil
+	}
+	b, _ := rd.ReadByte()
+	if b != '[' && b != 'O' {
+		return keyEsc, nil
+	}
+	c, _ := rd.ReadByte()
+	switch c {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '1', '4', '5', '6':
+		rd.ReadByte()
+		return map[byte]rune{'1': keyHome, '4': keyEnd, '5': keyPgUp, '6': keyPgDn}[c], nil
+	}
+	return keyEsc, nil
+}
+
+// Run the search again over the current time range
+func (cfg *config) tuiSearch(build func() (mozdefevents.Query, error), doctype string) error {
+	cfg.tui.events = nil
+	cfg.tui.haystack = nil
+	cfg.tui.sel = 0
+	cfg.tui.top = 0
+	cfg.collected = 0
+	qry, err := build()
+	if err != nil {
+		return err
+	}
+	err = cfg.runQuery(cfg.ctx, qry, doctype)
+	cfg.tui.applyFilter()
+	return err
+}
+
+// Change the time range to start and end and search again, restoring the
+// previous range if the new range is not valid
+func (cfg *config) tuiRange(w *bufio.Writer, start time.Time, end time.Time, build func() (mozdefevents.Query, error), doctype string) {
+	prevStart, prevEnd := cfg.startDate, cfg.endDate
+	cfg.startDate, cfg.endDate = start, end
+	err := cfg.validateDates(cfg.force)
+	if err != nil {
+		cfg.startDate, cfg.endDate = prevStart, prevEnd
+		cfg.tui.status = err.Error()
+		return
+	}
+	cfg.tui.status = "searching..."
+	cfg.tuiRender(w)
+	err = cfg.tuiSearch(build, doctype)
+	cfg.tui.status = ""
+	if err != nil {
+		cfg.tui.status = "error: " + err.Error()
+	}
+}
+
+// Handle a key, returning true to quit
+func (cfg *config) tuiKey(w *bufio.Writer, key rune, build func() (mozdefevents.Query, error), doctype string) bool {
+	t := cfg.tui
+	t.status = ""
+	if t.filtering {
+		switch key {
+		case '\r', '\n':
+			t.filtering = false
+		case keyEsc:
+			t.filtering = false
+			t.filter = ""
+		case 0x7f, 0x08:
+			if t.filter != "" {
+				r := []rune(t.filter)
+				t.filter = string(r[:len(r)-1])
+			}
+		default:
+			if key >= 0x20 && key < keyEsc {
+				t.filter += string(key)
+			}
+		}
+		t.applyFilter()
+		return false
+	}
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		height = 24
+	}
+	page := max((height-3)/2, 1)
+	window := cfg.endDate.Sub(cfg.startDate)
+	switch key {
+	case 'q', 0x03:
+		return true
+	case '\t':
+		t.detail = !t.detail
+	case 'j', keyDown:
+		if t.detail {
+			t.scroll++
+		} else {
+			t.move(1)
+		}
+	case 'k', keyUp:
+		if t.detail {
+			t.scroll = max(t.scroll-1, 0)
+		} else {
+			t.move(-1)
+		}
+	case keyPgDn, ' ':
+		t.move(page)
+	case keyPgUp:
+		t.move(-page)
+	case 'g', keyHome:
+		t.move(-len(t.visible))
+	case 'G', keyEnd:
+		t.move(len(t.visible))
+	case '/':
+		t.filtering = true
+	case keyEsc:
+		t.filter = ""
+		t.applyFilter()
+	case '[':
+		cfg.tuiRange(w, cfg.startDate.Add(-window), cfg.endDate.Add(-window), build, doctype)
+	case ']':
+		cfg.tuiRange(w, cfg.startDate.Add(window), cfg.endDate.Add(window), build, doctype)
+	case '-':
+		cfg.tuiRange(w, cfg.endDate.Add(-window/2), cfg.endDate, build, doctype)
+	case '+', '=':
+		cfg.tuiRange(w, cfg.endDate.Add(-window*2), cfg.endDate, build, doctype)
+	case 'r':
+		cfg.tuiRange(w, cfg.startDate, cfg.endDate, build, doctype)
+	}
+	return false
+}
+
+// Browse the results of the search interactively, the search is run before
+// the terminal is switched to the browser so errors are reported normally
+func (cfg *config) runTUI(build func() (mozdefevents.Query, error), doctype string) error {
+	err := cfg.tuiSearch(build, doctype)
+	if err != nil {
+		return err
+	}
+	in := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, state)
+	w := bufio.NewWriter(os.Stdout)
+	// Use the alternate screen so the terminal is restored on exit
+	fmt.Fprintf(w, "\x1b[?1049h\x1b[?25l\x1b[2J")
+	defer func() {
+		fmt.Fprintf(w, "\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+	rd := bufio.NewReader(os.Stdin)
+	for {
+		cfg.tuiRender(w)
+		key, err := readKey(rd)
+		if err != nil {
+			return err
+		}
+		if cfg.tuiKey(w, key, build, doctype) {
+			return nil
+		}
+	}
+}
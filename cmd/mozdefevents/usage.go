@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"io"
+	"os"
+	"runtime"
+	"time"
+)
+
+// runUsage tracks the resources consumed by a run, the request and document
+// counts are taken from the client
+type runUsage struct {
+	start time.Time
+}
+
+// usageSummary is the resource usage of a run. ResponseBytes is the size of
+// the search responses once decompressed, and SysMemory the memory obtained
+// from the OS by the runtime, which bounds the peak heap size.
+type usageSummary struct {
+	WallTime      string `json:"wall_time"`
+	Documents     int    `json:"documents"`
+	ResponseBytes int    `json:"response_bytes"`
+	SysMemory     uint64 `json:"sys_memory"`
+	Requests      int    `json:"requests"`
+	Retries       int    `json:"retries"`
+}
+
+type runMeta struct {
+	Mode      string       `json:"mode"`
+	StartDate time.Time    `json:"start_date"`
+	EndDate   time.Time    `json:"end_date"`
+	Usage     usageSummary `json:"usage"`
+}
+
+func (cfg *config) usageSummary() usageSummary {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	var stats mozdefevents.Stats
+	if cfg.conn != nil {
+		stats = cfg.conn.Stats()
+	}
+	return usageSummary{
+		WallTime:      time.Since(cfg.usage.start).Round(time.Millisecond).String(),
+		Documents:     stats.Documents,
+		ResponseBytes: stats.ResponseBytes,
+		SysMemory:     ms.Sys,
+		Requests:      stats.Requests,
+		Retries:       stats.Retries,
+	}
+}
+
+func (cfg *config) renderUsage(w io.Writer) {
+	s := cfg.usageSummary()
+	fmt.Fprintf(w, "wall time %v, %v documents, %v response bytes, %v bytes memory from os, "+
+		"%v requests, %v retries\n", s.WallTime, s.Documents, s.ResponseBytes,
+		s.SysMemory, s.Requests, s.Retries)
+}
+
+// Write run metadata including resource usage as JSON to path
+func (cfg *config) writeMeta(path string, mode string) error {
+	meta := runMeta{
+		Mode:      mode,
+		StartDate: cfg.startDate,
+		EndDate:   cfg.endDate,
+		Usage:     cfg.usageSummary(),
+	}
+	buf, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(buf, '\n'), 0644)
+}
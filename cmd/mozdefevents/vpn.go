@@ -0,0 +1,181 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"regexp"
+)
+
+// vpnSession is a VPN session event parsed from the summary of an OpenVPN
+// syslog event, the connection of a client, the address assigned to it or
+// its disconnection
+type vpnSession struct {
+	Event    string
+	User     string
+	Source   string
+	Assigned string
+	Reason   string
+}
+
+// The OpenVPN messages for session events, the summary may still carry the
+// openvpn[pid] prefix depending on how the event was ingested
+var (
+	vpnConnectRe    = regexp.MustCompile(`^(?:\S+\[\d+\]: )?(\S+):\d+ \[(\S+)\] Peer Connection Initiated`)
+	vpnAssignRe     = regexp.MustCompile(`^(?:\S+\[\d+\]: )?([^/\s]+)/(\S+):\d+ MULTI_sva: pool returned IPv4=([0-9.]+)`)
+	vpnDisconnectRe = regexp.MustCompile(`^(?:\S+\[\d+\]: )?([^/\s]+)/(\S+):\d+ (?:SIG\w+\[\w+,([\w-]+)\] received|(Connection reset|Inactivity timeout))`)
+)
+
+// Parse an OpenVPN summary, returning false if it is not a session event
+func parseVPNSession(summary string) (vpnSession, bool) {
+	if m := vpnConnectRe.FindStringSubmatch(summary); m != nil {
+		return vpnSession{Event: "connect", User: m[2], Source: m[1]}, true
+	}
+	if m := vpnAssignRe.FindStringSubmatch(summary); m != nil {
+		return vpnSession{Event: "assign", User: m[1], Source: m[2], Assigned: m[3]}, true
+	}
+	if m := vpnDisconnectRe.FindStringSubmatch(summary); m != nil {
+		reason := m[3]
+		if reason == "" {
+			reason = m[4]
+		}
+		return vpnSession{Event: "disconnect", User: m[1], Source: m[2], Reason: reason}, true
+	}
+	return vpnSession{}, false
+}
+
+// vpnFilter selects the session events shown by the vpn subcommand
+type vpnFilter struct {
+	user     string
+	source   string
+	assigned string
+	event    string
+}
+
+func (f vpnFilter) match(e mozdefevents.Event) bool {
+	s, ok := parseVPNSession(e.Summary)
+	if !ok {
+		return false
+	}
+	switch {
+	case f.user != "" && s.User != f.user:
+		return false
+	case f.source != "" && s.Source != f.source:
+		return false
+	case f.assigned != "" && s.Assigned != f.assigned:
+		return false
+	case f.event != "" && s.Event != f.event:
+		return false
+	}
+	return true
+}
+
+// Build a search for OpenVPN session messages, the summary criteria narrow
+// the search and the events are then matched exactly by vpnFilter
+func (cfg *config) buildVPNSearch(f vpnFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	ret.AddMatch("category", "syslog")
+	ret.AddMatch("details.program", "openvpn")
+	words := map[string][]string{
+		"connect":    {"Initiated"},
+		"assign":     {"MULTI_sva"},
+		"disconnect": {"received", "reset", "Inactivity"},
+	}
+	should := make([]mozdefevents.Criteria, 0)
+	for _, x := range []string{"connect", "assign", "disconnect"} {
+		if f.event != "" && f.event != x {
+			continue
+		}
+		for _, y := range words[x] {
+			should = append(should, mozdefevents.Criteria{Match: map[string]string{"summary": y}})
+		}
+	}
+	clause, err := cfg.shouldClause(should)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	for _, x := range []string{f.user, f.source, f.assigned} {
+		if x != "" {
+			ret.AddMatch("summary", x)
+		}
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show VPN session events, other openvpn events such as those shown with
+// -context are shown as syslog events
+func (cfg *config) vpnResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		s, ok := parseVPNSession(x.Summary)
+		if !ok {
+			cfg.syslogResults([]mozdefevents.Event{x})
+			continue
+		}
+		evstr := fmt.Sprintf("[vpn] %v user:%v from:%v", s.Event, s.User, s.Source)
+		if s.Assigned != "" {
+			evstr += " ip:" + s.Assigned
+		}
+		if s.Reason != "" {
+			evstr += fmt.Sprintf(" (%v)", s.Reason)
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, x.Details.Hostname), evstr)
+	}
+}
+
+func (cfg *config) runVPN(args []string) error {
+	fs := cfg.newFlagSet("vpn", "", "Search for OpenVPN session events, showing the connection, assigned address and\n"+
+		"disconnection of each client with the user and source address.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f vpnFilter
+	fs.StringVar(&f.user, "user", "", "match sessions for user")
+	fs.StringVar(&f.source, "from", "", "match sessions from source address")
+	fs.StringVar(&f.assigned, "assigned", "", "match sessions assigned VPN address")
+	fs.StringVar(&f.event, "event", "", "match session events of type, connect, assign or disconnect")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	switch f.event {
+	case "", "connect", "assign", "disconnect":
+	default:
+		return errors.New("-event must be connect, assign or disconnect")
+	}
+	if f.assigned != "" && f.event != "" && f.event != "assign" {
+		return errors.New("-assigned can only be combined with -event assign")
+	}
+	if f.assigned != "" {
+		f.event = "assign"
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEVPN
+	cfg.eventFilter = f.match
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildVPNSearch(f)
+	}
+	return cfg.runSearch(so, eo, "vpn", build, "event")
+}
@@ -0,0 +1,151 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The sources of Windows events shipped into MozDef
+var windowsSources = []string{"winlogbeat", "nxlog"}
+
+// windowsFilter holds the criteria of the windows subcommand, which are
+// matched by the search
+type windowsFilter struct {
+	eventids  []string
+	logontype string
+	channel   string
+	user      string
+}
+
+// Parse a comma separated list of numeric IDs
+func parseIDs(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ret := strings.Split(s, ",")
+	for i, x := range ret {
+		ret[i] = strings.TrimSpace(x)
+		_, err := strconv.Atoi(ret[i])
+		if err != nil {
+			return nil, fmt.Errorf("id %q is not numeric", x)
+		}
+	}
+	return ret, nil
+}
+
+func (cfg *config) buildWindowsSearch(f windowsFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("event", cfg.esVersion)
+	clause, err := cfg.matchValuesClause("source", windowsSources)
+	if err != nil {
+		return ret, err
+	}
+	ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	if len(f.eventids) > 0 {
+		clause, err = cfg.matchValuesClause("details.eventid", f.eventids)
+		if err != nil {
+			return ret, err
+		}
+		ret.Query.Bool.Filter = append(ret.Query.Bool.Filter, clause)
+	}
+	if f.logontype != "" {
+		ret.AddMatch("details.logontype", f.logontype)
+	}
+	if f.channel != "" {
+		ret.AddMatch("details.channel", f.channel)
+	}
+	if f.user != "" {
+		ret.AddMatch("details.targetusername", f.user)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Show Windows events with the channel and event ID, and the target user and
+// logon type of logon events
+func (cfg *config) windowsResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		d := x.Details
+		channel := d.Channel
+		if channel == "" {
+			channel = "unknown"
+		}
+		eventid := string(d.EventID)
+		if eventid == "" {
+			eventid = "-"
+		}
+		evstr := fmt.Sprintf("[windows] (%v/%v)", channel, eventid)
+		if d.TargetUserName != "" {
+			evstr += " target:" + d.TargetUserName
+		}
+		if d.LogonType != "" {
+			evstr += fmt.Sprintf(" logontype:%v", d.LogonType)
+		}
+		if d.SourceIPAddress != "" {
+			evstr += " from:" + d.SourceIPAddress
+		}
+		if x.Summary != "" {
+			evstr += " " + firstLine(x.Summary)
+		}
+		host := x.Hostname
+		if host == "" {
+			host = d.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), evstr)
+	}
+}
+
+// Return the first line of s, Windows event messages run over many lines
+func firstLine(s string) string {
+	ret, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(ret)
+}
+
+func (cfg *config) runWindows(args []string) error {
+	fs := cfg.newFlagSet("windows", "", "Search for Windows event log events shipped with winlogbeat or nxlog, showing\n"+
+		"the channel, event ID, target user and logon type of each.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	eventids := fs.String("eventid", "", "match events with event ID, or any of a comma separated list (e.g., 4624,4625)")
+	var f windowsFilter
+	fs.StringVar(&f.logontype, "logontype", "", "match logon events with logon type (e.g., 10 for remote interactive)")
+	fs.StringVar(&f.channel, "channel", "", "match events from channel (e.g., Security)")
+	fs.StringVar(&f.user, "target", "", "match events for target user name")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	f.eventids, err = parseIDs(*eventids)
+	if err != nil {
+		return err
+	}
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEWINDOWS
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildWindowsSearch(f)
+	}
+	return cfg.runSearch(so, eo, "windows", build, "event")
+}
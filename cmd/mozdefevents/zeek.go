@@ -0,0 +1,148 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package main
+
+import (
+	"fmt"
+	"github.com/ameihm0912/mozdefevents"
+	"os"
+	"strings"
+)
+
+// zeekFilter holds the criteria of the zeek subcommand, which are matched
+// by the search
+type zeekFilter struct {
+	log     string
+	uid     string
+	service string
+}
+
+// Build a search for Zeek events, the log type is held in the source field
+func (cfg *config) buildZeekSearch(f zeekFilter) (mozdefevents.Query, error) {
+	var ret mozdefevents.Query
+	err := cfg.defaultSettings(&ret)
+	if err != nil {
+		return ret, err
+	}
+	ret.AddTypeMatch("bro", cfg.esVersion)
+	if f.log != "" {
+		ret.AddMatch("source", f.log)
+	}
+	if f.uid != "" {
+		ret.AddMatch("details.uid", f.uid)
+	}
+	if f.service != "" {
+		ret.AddMatch("details.service", f.service)
+	}
+	ret.ApplyNested(cfg.nestedPath)
+	return ret, nil
+}
+
+// Return the display string for a Zeek conn log event
+func zeekConnString(d mozdefevents.EventDetails) string {
+	proto := d.Proto
+	if proto == "" {
+		proto = "unknown"
+	}
+	if d.Service != "" {
+		proto += "/" + d.Service
+	}
+	ret := fmt.Sprintf("%v %v -> %v", proto, displayAddr(d.SourceIPAddress, d.SourcePort),
+		displayAddr(d.DestinationIPAddress, d.DestinationPort))
+	if d.OrigBytes != "" || d.RespBytes != "" {
+		ret += fmt.Sprintf(" bytes:%v/%v", d.OrigBytes, d.RespBytes)
+	}
+	return ret
+}
+
+// Return the display string for a Zeek dns log event
+func zeekDNSString(d mozdefevents.EventDetails) string {
+	ret := fmt.Sprintf("%v -> %v query:%q", d.SourceIPAddress, d.DestinationIPAddress, d.Query)
+	if d.QTypeName != "" {
+		ret += " type:" + d.QTypeName
+	}
+	if d.RCodeName != "" {
+		ret += " rcode:" + d.RCodeName
+	}
+	return ret
+}
+
+// Return the display string for a Zeek http log event
+func zeekHTTPString(d mozdefevents.EventDetails) string {
+	ret := fmt.Sprintf("%v -> %v %v host:%q uri:%q", d.SourceIPAddress,
+		displayAddr(d.DestinationIPAddress, d.DestinationPort), d.Method, d.Host, d.URI)
+	if d.StatusCode != "" {
+		ret += fmt.Sprintf(" status:%v", d.StatusCode)
+	}
+	return ret
+}
+
+// Show Zeek events in the format for their log type, logs without a
+// dedicated format are shown with their summary
+func (cfg *config) zeekResults(results []mozdefevents.Event) {
+	for _, x := range results {
+		log := strings.ToLower(x.Source)
+		if log == "" {
+			log = "unknown"
+		}
+		var evstr string
+		switch log {
+		case "conn":
+			evstr = zeekConnString(x.Details)
+		case "dns":
+			evstr = zeekDNSString(x.Details)
+		case "http":
+			evstr = zeekHTTPString(x.Details)
+		default:
+			evstr = x.Summary
+			if evstr == "" {
+				evstr = "no summary found in event"
+			}
+		}
+		uid := x.Details.UID
+		if uid == "" {
+			uid = "-"
+		}
+		host := x.Hostname
+		if host == "" {
+			host = x.Details.Hostname
+		}
+		fmt.Fprintf(os.Stdout, "%v %v [zeek %v] %v %v\n", cfg.displayTime(x.Timestamp),
+			displayHost(x, host), log, uid, evstr)
+	}
+}
+
+func (cfg *config) runZeek(args []string) error {
+	fs := cfg.newFlagSet("zeek", "", "Search for Zeek (Bro) events, showing conn, dns and http log events in a format\n"+
+		"for each log type.")
+	so := cfg.addSearchFlags(fs)
+	eo := cfg.addEventFlags(fs)
+	var f zeekFilter
+	fs.StringVar(&f.log, "log", "", "match events from log type (e.g., conn, dns, http)")
+	fs.StringVar(&f.uid, "uid", "", "match events for connection uid")
+	fs.StringVar(&f.service, "service", "", "match events for service (e.g., ssh, dns)")
+	err := cfg.parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	err = so.apply(cfg)
+	if err != nil {
+		return err
+	}
+	err = eo.apply(cfg, *so.noop)
+	if err != nil {
+		return err
+	}
+	cfg.mode = MODEZEEK
+	f.log = strings.ToLower(f.log)
+	build := func() (mozdefevents.Query, error) {
+		return cfg.buildZeekSearch(f)
+	}
+	return cfg.runSearch(so, eo, "zeek", build, "bro")
+}
@@ -0,0 +1,315 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Enricher adds information to a normalized event. A Client runs the
+// enrichers given with WithEnrichers on each event a search returns, in
+// order, before the events are passed to the search handler.
+type Enricher interface {
+	Enrich(ctx context.Context, e *Event) error
+}
+
+// EnricherFunc adapts a function to the Enricher interface
+type EnricherFunc func(ctx context.Context, e *Event) error
+
+func (f EnricherFunc) Enrich(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// EnricherChain runs a list of enrichers in order, stopping at the first
+// error
+type EnricherChain []Enricher
+
+func (c EnricherChain) Enrich(ctx context.Context, e *Event) error {
+	for _, x := range c {
+		err := x.Enrich(ctx, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultEnricherOrder is the order the standard enrichers are intended to
+// run in, each can use the fields set by those before it
+var DefaultEnricherOrder = []string{"geoip", "rdns", "asset", "scoring"}
+
+var (
+	enricherMu       sync.Mutex
+	enricherRegistry = make(map[string]func() (Enricher, error))
+)
+
+// RegisterEnricher makes an enricher available by name for use in a chain
+// built with NewEnricherChain, replacing any enricher registered with the
+// same name. factory is called for each chain the enricher is used in.
+func RegisterEnricher(name string, factory func() (Enricher, error)) {
+	enricherMu.Lock()
+	defer enricherMu.Unlock()
+	enricherRegistry[name] = factory
+}
+
+// EnricherNames returns the names of the registered enrichers in name order
+func EnricherNames() []string {
+	enricherMu.Lock()
+	defer enricherMu.Unlock()
+	ret := make([]string, 0, len(enricherRegistry))
+	for k := range enricherRegistry {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// NewEnricherChain builds a chain from a list of registered enricher names
+func NewEnricherChain(names []string) (EnricherChain, error) {
+	ret := make(EnricherChain, 0, len(names))
+	for _, x := range names {
+		enricherMu.Lock()
+		factory, ok := enricherRegistry[x]
+		enricherMu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown enricher %q, must be one of %v",
+				x, strings.Join(EnricherNames(), ", "))
+		}
+		e, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("enricher %v: %v", x, err)
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+// GeoLocation is the location of an address, as set by the MozDef geoip
+// plugin
+type GeoLocation struct {
+	CountryCode string `json:"country_code,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// GeoIPDatabase maps networks to locations, an address is located by the
+// most specific network containing it
+type GeoIPDatabase struct {
+	// Networks keyed by prefix length and then network address
+	networks map[int]map[string]GeoLocation
+	lengths  []int
+}
+
+// NewGeoIPDatabase returns an empty database
+func NewGeoIPDatabase() *GeoIPDatabase {
+	return &GeoIPDatabase{networks: make(map[int]map[string]GeoLocation)}
+}
+
+// Add sets the location of the addresses in network, given in CIDR notation
+func (g *GeoIPDatabase) Add(network string, loc GeoLocation) error {
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return err
+	}
+	ones, bits := n.Mask.Size()
+	// IPv4 and IPv6 networks are kept apart by the prefix length of the
+	// 16 byte form
+	if bits == 32 {
+		ones += 96
+	}
+	m, ok := g.networks[ones]
+	if !ok {
+		m = make(map[string]GeoLocation)
+		g.networks[ones] = m
+		g.lengths = append(g.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(g.lengths)))
+	}
+	m[string(n.IP.To16())] = loc
+	return nil
+}
+
+// Lookup returns the location of addr, false if addr is not in any network
+func (g *GeoIPDatabase) Lookup(addr string) (GeoLocation, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return GeoLocation{}, false
+	}
+	ip = ip.To16()
+	for _, x := range g.lengths {
+		key := ip.Mask(net.CIDRMask(x, 128))
+		if loc, ok := g.networks[x][string(key)]; ok {
+			return loc, true
+		}
+	}
+	return GeoLocation{}, false
+}
+
+// LoadGeoIPCSV reads a database from CSV records of network, country code,
+// country name and city, with an optional header record starting with
+// network
+func LoadGeoIPCSV(r io.Reader) (*GeoIPDatabase, error) {
+	ret := NewGeoIPDatabase()
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	cr.Comment = '#'
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && rec[0] == "network" {
+			continue
+		}
+		err = ret.Add(rec[0], GeoLocation{CountryCode: rec[1], CountryName: rec[2], City: rec[3]})
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+	}
+	return ret, nil
+}
+
+// NewGeoIPEnricher returns an enricher setting the location of the source
+// address of an event from db, unless the event already has a location
+func NewGeoIPEnricher(db *GeoIPDatabase) Enricher {
+	return EnricherFunc(func(ctx context.Context, e *Event) error {
+		if e.Details.SourceIPAddress == "" || e.Details.SourceIPGeolocation != nil {
+			return nil
+		}
+		if loc, ok := db.Lookup(e.Details.SourceIPAddress); ok {
+			e.Details.SourceIPGeolocation = &loc
+		}
+		return nil
+	})
+}
+
+// rdnsEnricher resolves the source IP address of an event, caching results
+// since the same addresses tend to appear repeatedly
+type rdnsEnricher struct {
+	sync.Mutex
+	cache map[string]string
+}
+
+// NewRDNSEnricher returns an enricher setting the source hostname of an
+// event to the reverse DNS name of its source address
+func NewRDNSEnricher() Enricher {
+	return &rdnsEnricher{cache: make(map[string]string)}
+}
+
+func (r *rdnsEnricher) Enrich(ctx context.Context, e *Event) error {
+	addr := e.Details.SourceIPAddress
+	if addr == "" || e.Details.SourceHostname != "" {
+		return nil
+	}
+	r.Lock()
+	v, ok := r.cache[addr]
+	r.Unlock()
+	if ok {
+		e.Details.SourceHostname = v
+		return nil
+	}
+	var name string
+	names, err := net.DefaultResolver.LookupAddr(ctx, addr)
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	r.Lock()
+	r.cache[addr] = name
+	r.Unlock()
+	e.Details.SourceHostname = name
+	return nil
+}
+
+// Asset is an asset group and the hostnames of its members
+type Asset struct {
+	Group string
+	Hosts []*regexp.Regexp
+}
+
+// NewAssetEnricher returns an enricher setting the asset group of an event
+// to the first of assets with a host matching the hostname of the event,
+// unless the event already has an asset group
+func NewAssetEnricher(assets []Asset) Enricher {
+	return EnricherFunc(func(ctx context.Context, e *Event) error {
+		if e.Details.AssetGroup != "" {
+			return nil
+		}
+		host := e.Hostname
+		if host == "" {
+			host = e.Details.Hostname
+		}
+		if host == "" {
+			return nil
+		}
+		for _, x := range assets {
+			for _, y := range x.Hosts {
+				if y.MatchString(host) {
+					e.Details.AssetGroup = x.Group
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// ScoreRule adds Score to the score of an event if the value of Field, a
+// dotted field path, matches Match
+type ScoreRule struct {
+	Field string
+	Match *regexp.Regexp
+	Score int
+}
+
+// DefaultScoreRules score events by severity
+var DefaultScoreRules = []ScoreRule{
+	{Field: "severity", Match: regexp.MustCompile(`^(?i)warning$`), Score: 1},
+	{Field: "severity", Match: regexp.MustCompile(`^(?i)error$`), Score: 2},
+	{Field: "severity", Match: regexp.MustCompile(`^(?i)critical$`), Score: 3},
+	{Field: "severity", Match: regexp.MustCompile(`^(?i)(alert|emergency)$`), Score: 4},
+}
+
+// NewScoringEnricher returns an enricher setting the score of an event to
+// the sum of the scores of the rules it matches. Rules can match fields set
+// by enrichers earlier in the chain, such as the asset group.
+func NewScoringEnricher(rules []ScoreRule) Enricher {
+	return EnricherFunc(func(ctx context.Context, e *Event) error {
+		score := 0
+		for _, x := range rules {
+			v, err := e.FieldValue(x.Field)
+			if err != nil {
+				return err
+			}
+			if v != "" && x.Match.MatchString(v) {
+				score += x.Score
+			}
+		}
+		e.Score = score
+		return nil
+	})
+}
+
+func init() {
+	RegisterEnricher("rdns", func() (Enricher, error) {
+		return NewRDNSEnricher(), nil
+	})
+	RegisterEnricher("scoring", func() (Enricher, error) {
+		return NewScoringEnricher(DefaultScoreRules), nil
+	})
+}
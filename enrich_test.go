@@ -0,0 +1,131 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGeoIPDatabase(t *testing.T) {
+	db, err := LoadGeoIPCSV(strings.NewReader(`network,country_code,country_name,city
+# comment
+203.0.113.0/24,AU,Australia,
+203.0.113.128/25,NZ,New Zealand,Auckland
+2001:db8::/32,US,United States,Portland
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"203.0.113.5", "AU"},
+		{"203.0.113.200", "NZ"},
+		{"2001:db8::1", "US"},
+		{"198.51.100.1", ""},
+		{"not an address", ""},
+	}
+	for _, x := range tests {
+		loc, ok := db.Lookup(x.addr)
+		if ok != (x.want != "") || loc.CountryCode != x.want {
+			t.Errorf("%v: got %v %v, want %v", x.addr, loc.CountryCode, ok, x.want)
+		}
+	}
+	_, err = LoadGeoIPCSV(strings.NewReader("203.0.113.0/33,AU,Australia,\n"))
+	if err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
+
+func TestEnricherChain(t *testing.T) {
+	order := make([]string, 0)
+	RegisterEnricher("test-a", func() (Enricher, error) {
+		return EnricherFunc(func(ctx context.Context, e *Event) error {
+			order = append(order, "a")
+			return nil
+		}), nil
+	})
+	RegisterEnricher("test-b", func() (Enricher, error) {
+		return EnricherFunc(func(ctx context.Context, e *Event) error {
+			order = append(order, "b")
+			return nil
+		}), nil
+	})
+	chain, err := NewEnricherChain([]string{"test-b", "test-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = chain.Enrich(context.Background(), &Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "b,a" {
+		t.Errorf("enrichers ran in order %v", order)
+	}
+	_, err = NewEnricherChain([]string{"test-missing"})
+	if err == nil || !strings.Contains(err.Error(), "test-a") {
+		t.Errorf("expected unknown enricher error listing enrichers, got %v", err)
+	}
+}
+
+func TestClientEnrichers(t *testing.T) {
+	m := NewMockBackend()
+	err := m.Add("events-20240305",
+		json.RawMessage(`{"type":"event","hostname":"web1.example.com","severity":"CRITICAL","details":{"sourceipaddress":"203.0.113.5"}}`),
+		json.RawMessage(`{"type":"event","hostname":"db1.example.com","severity":"INFO","details":{"sourceipaddress":"198.51.100.1","asset_group":"databases"}}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewGeoIPDatabase()
+	err = db.Add("203.0.113.0/24", GeoLocation{CountryCode: "AU"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := []Asset{{Group: "web", Hosts: []*regexp.Regexp{regexp.MustCompile(`^web\d+\.`)}}}
+	rules := append([]ScoreRule{
+		{Field: "details.asset_group", Match: regexp.MustCompile(`^web$`), Score: 10},
+		{Field: "details.sourceipgeolocation.country_code", Match: regexp.MustCompile(`^AU$`), Score: 100},
+	}, DefaultScoreRules...)
+	c, err := NewClient(nil, WithBackend(m), WithVersion(Version{Major: 7}), WithoutReconcile(),
+		WithEnrichers(NewGeoIPEnricher(db), NewAssetEnricher(assets), NewScoringEnricher(rules)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := Query{Size: 10}
+	q.AddMatch("type", "event")
+	events := make([]Event, 0)
+	err = c.Search(context.Background(), "events-20240305", "", q, func(results []Event) error {
+		events = append(events, results...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %v events, want 2", len(events))
+	}
+	web, dbhost := events[0], events[1]
+	if web.Details.SourceIPGeolocation == nil || web.Details.SourceIPGeolocation.CountryCode != "AU" {
+		t.Errorf("web event not located, got %+v", web.Details.SourceIPGeolocation)
+	}
+	if web.Details.AssetGroup != "web" {
+		t.Errorf("web event asset group %q", web.Details.AssetGroup)
+	}
+	if web.Score != 113 {
+		t.Errorf("web event score %v, want 113", web.Score)
+	}
+	if dbhost.Details.SourceIPGeolocation != nil || dbhost.Details.AssetGroup != "databases" || dbhost.Score != 0 {
+		t.Errorf("db event enriched unexpectedly, %+v score %v", dbhost.Details, dbhost.Score)
+	}
+}
@@ -0,0 +1,409 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Event is a MozDef event as returned by a search
+type Event struct {
+	ID                string          `json:"-"`
+	Raw               json.RawMessage `json:"-"`
+	Cluster           string          `json:"cluster,omitempty"`
+	Category          string          `json:"category"`
+	Hostname          string          `json:"hostname"`
+	Timestamp         time.Time       `json:"timestamp"`
+	UTCTimestamp      time.Time       `json:"utctimestamp"`
+	ReceivedTimestamp time.Time       `json:"receivedtimestamp"`
+	Summary           string          `json:"summary"`
+	Severity          string          `json:"severity"`
+	Tags              []string        `json:"tags"`
+	Source            string          `json:"source,omitempty"`
+	Details           EventDetails    `json:"details"`
+	Score             int             `json:"score,omitempty"`
+}
+
+// EventDetails holds the details fields of an event used by the normalized
+// event
+type EventDetails struct {
+	Hostname             string        `json:"hostname"`
+	Command              string        `json:"command"`
+	DHost                string        `json:"dhost"`
+	DProc                string        `json:"dproc"`
+	DUser                string        `json:"duser"`
+	SUser                string        `json:"suser"`
+	Fname                string        `json:"fname"`
+	Name                 string        `json:"name"`
+	ProcessName          string        `json:"processname"`
+	OriginalUser         string        `json:"originaluser"`
+	User                 string        `json:"user"`
+	Path                 string        `json:"path"`
+	Program              string        `json:"program"`
+	AuditKey             string        `json:"auditkey"`
+	Ses                  string        `json:"ses"`
+	AssetGroup           string        `json:"asset_group"`
+	SourceIPAddress      string        `json:"sourceipaddress"`
+	SourceHostname       string        `json:"sourcehostname,omitempty"`
+	SourceIPGeolocation  *GeoLocation  `json:"sourceipgeolocation,omitempty"`
+	Mode                 string        `json:"mode,omitempty"`
+	OUID                 string        `json:"ouid,omitempty"`
+	OGID                 string        `json:"ogid,omitempty"`
+	SContext             string        `json:"scontext,omitempty"`
+	TContext             string        `json:"tcontext,omitempty"`
+	TClass               string        `json:"tclass,omitempty"`
+	Denied               string        `json:"denied,omitempty"`
+	DestinationIPAddress string        `json:"destinationipaddress,omitempty"`
+	SourcePort           Port          `json:"sourceport,omitempty"`
+	DestinationPort      Port          `json:"destinationport,omitempty"`
+	Proto                string        `json:"proto,omitempty"`
+	Action               string        `json:"action,omitempty"`
+	UID                  string        `json:"uid,omitempty"`
+	Service              string        `json:"service,omitempty"`
+	OrigBytes            json.Number   `json:"orig_bytes,omitempty"`
+	RespBytes            json.Number   `json:"resp_bytes,omitempty"`
+	Query                string        `json:"query,omitempty"`
+	QTypeName            string        `json:"qtype_name,omitempty"`
+	RCodeName            string        `json:"rcode_name,omitempty"`
+	Host                 string        `json:"host,omitempty"`
+	Method               string        `json:"method,omitempty"`
+	URI                  string        `json:"uri,omitempty"`
+	StatusCode           json.Number   `json:"status_code,omitempty"`
+	EventName            string        `json:"eventname,omitempty"`
+	AWSRegion            string        `json:"awsregion,omitempty"`
+	UserIdentity         *UserIdentity `json:"useridentity,omitempty"`
+	ErrorCode            string        `json:"errorcode,omitempty"`
+	EventID              Number        `json:"eventid,omitempty"`
+	Channel              string        `json:"channel,omitempty"`
+	TargetUserName       string        `json:"targetusername,omitempty"`
+	LogonType            Number        `json:"logontype,omitempty"`
+	Username             string        `json:"username,omitempty"`
+	Factor               string        `json:"factor,omitempty"`
+	Result               string        `json:"result,omitempty"`
+	Integration          string        `json:"integration,omitempty"`
+	Device               string        `json:"device,omitempty"`
+	Rule                 *HIDSRule     `json:"rule,omitempty"`
+	Decoded              DecodedFields `json:"data,omitempty"`
+	Destination          string        `json:"destination,omitempty"`
+	Status               Number        `json:"status,omitempty"`
+	ResponseSize         Number        `json:"responsesize,omitempty"`
+	ProxyAction          string        `json:"proxyaction,omitempty"`
+}
+
+// HIDSRule is the OSSEC or Wazuh rule that raised an alert
+type HIDSRule struct {
+	ID          Number `json:"id,omitempty"`
+	Level       Number `json:"level,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// UnmarshalJSON decodes a rule, ignoring a rule field that is not an object
+// as some event sources use the field for a rule name
+func (r *HIDSRule) UnmarshalJSON(buf []byte) error {
+	if len(buf) == 0 || buf[0] != '{' {
+		return nil
+	}
+	type plain HIDSRule
+	return json.Unmarshal(buf, (*plain)(r))
+}
+
+// DecodedFields are the fields an OSSEC or Wazuh decoder extracted from the
+// log message
+type DecodedFields map[string]string
+
+// UnmarshalJSON decodes the fields, ignoring a data field that is not an
+// object and converting values that are not strings to their JSON encoding
+func (d *DecodedFields) UnmarshalJSON(buf []byte) error {
+	if len(buf) == 0 || buf[0] != '{' {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(buf, &fields)
+	if err != nil {
+		return err
+	}
+	*d = make(DecodedFields, len(fields))
+	for k, v := range fields {
+		var s string
+		if json.Unmarshal(v, &s) != nil {
+			s = string(v)
+		}
+		(*d)[k] = s
+	}
+	return nil
+}
+
+// UserIdentity is the identity that made a CloudTrail request
+type UserIdentity struct {
+	Type      string `json:"type,omitempty"`
+	ARN       string `json:"arn,omitempty"`
+	AccountID string `json:"accountid,omitempty"`
+}
+
+// Number is a numeric field, which is a number or a string depending on the
+// event source
+type Number string
+
+// UnmarshalJSON decodes a number from either a number or a string
+func (n *Number) UnmarshalJSON(buf []byte) error {
+	if string(buf) == "null" {
+		return nil
+	}
+	var s string
+	if json.Unmarshal(buf, &s) == nil {
+		*n = Number(s)
+		return nil
+	}
+	var v json.Number
+	err := json.Unmarshal(buf, &v)
+	if err != nil {
+		return err
+	}
+	*n = Number(v.String())
+	return nil
+}
+
+// Port is a port number field
+type Port string
+
+// UnmarshalJSON decodes a port from either a number or a string
+func (p *Port) UnmarshalJSON(buf []byte) error {
+	return (*Number)(p).UnmarshalJSON(buf)
+}
+
+// AuditCategories maps the audit event names found in details.name, and the
+// syscall categories used by some audit plugins, to the category an event is
+// normalized to
+var AuditCategories = map[string]string{
+	"Unix Exec":               "execve",
+	"AVC":                     "avc",
+	"Write or append to file": "write",
+	"Change file mode":        "chmod",
+	"Change file owner":       "chown",
+	"Change file attributes":  "attribute",
+	"fchmod":                  "chmod",
+	"fchmodat":                "chmod",
+	"fchown":                  "chown",
+	"fchownat":                "chown",
+	"lchown":                  "chown",
+	"setxattr":                "attribute",
+	"lsetxattr":               "attribute",
+	"fsetxattr":               "attribute",
+	"removexattr":             "attribute",
+	"lremovexattr":            "attribute",
+	"fremovexattr":            "attribute",
+}
+
+// SourceFields are the document fields used by Event, a search can limit
+// the returned source to these fields to reduce the response size
+var SourceFields = []string{
+	"category", "hostname", "timestamp", "utctimestamp", "receivedtimestamp",
+	"summary", "severity", "tags", "type",
+	"details.hostname", "details.command", "details.dhost", "details.dproc",
+	"details.duser", "details.suser", "details.fname", "details.name",
+	"details.processname", "details.originaluser", "details.user",
+	"details.path", "details.program", "details.auditkey", "details.ses",
+	"details.asset_group", "details.sourceipaddress", "details.sourcehostname",
+	"details.mode", "details.ouid", "details.ogid", "details.scontext",
+	"details.tcontext", "details.tclass", "details.denied",
+	"details.destinationipaddress", "details.sourceport", "details.destinationport",
+	"details.proto", "details.action", "source", "details.uid",
+	"details.service", "details.orig_bytes", "details.resp_bytes",
+	"details.query", "details.qtype_name", "details.rcode_name",
+	"details.host", "details.method", "details.uri", "details.status_code",
+	"details.eventname", "details.awsregion", "details.useridentity.type",
+	"details.useridentity.arn", "details.useridentity.accountid",
+	"details.errorcode", "details.eventid", "details.channel",
+	"details.targetusername", "details.logontype", "details.username",
+	"details.factor", "details.result", "details.integration", "details.device",
+	"details.rule.id", "details.rule.level", "details.rule.description",
+	"details.data", "details.destination", "details.status",
+	"details.responsesize", "details.proxyaction", "details.sourceipgeolocation",
+}
+
+// The SELinux AVC message, e.g. avc:  denied  { read } for pid=1 comm="x"
+// scontext=... tcontext=... tclass=file
+var (
+	avcDeniedRe = regexp.MustCompile(`avc:\s+denied\s+\{\s*([^}]*?)\s*\}`)
+	avcFieldRe  = regexp.MustCompile(`\b(scontext|tcontext|tclass)=(\S+)`)
+	avcCommRe   = regexp.MustCompile(`\bcomm="([^"]*)"`)
+)
+
+// Fill in the AVC details fields from the summary of an AVC denial, for
+// events where the audit plugin did not set them. Denials forwarded through
+// syslog keep the syslog category.
+func (e *Event) normalizeAVC() {
+	m := avcDeniedRe.FindStringSubmatch(e.Summary)
+	if m == nil {
+		return
+	}
+	if e.Category != "syslog" {
+		e.Category = "avc"
+	}
+	if e.Details.Denied == "" {
+		e.Details.Denied = m[1]
+	}
+	for _, x := range avcFieldRe.FindAllStringSubmatch(e.Summary, -1) {
+		switch {
+		case x[1] == "scontext" && e.Details.SContext == "":
+			e.Details.SContext = x[2]
+		case x[1] == "tcontext" && e.Details.TContext == "":
+			e.Details.TContext = x[2]
+		case x[1] == "tclass" && e.Details.TClass == "":
+			e.Details.TClass = x[2]
+		}
+	}
+	if m := avcCommRe.FindStringSubmatch(e.Summary); m != nil && e.Details.ProcessName == "" {
+		e.Details.ProcessName = m[1]
+	}
+}
+
+// The fields of a netfilter log message, e.g. DROP IN=eth0 OUT= SRC=...
+// DST=... PROTO=TCP SPT=... DPT=..., the log prefix names the action
+var (
+	netfilterFieldRe  = regexp.MustCompile(`\b(SRC|DST|PROTO|SPT|DPT)=(\S+)`)
+	netfilterActionRe = regexp.MustCompile(`(?i)\b(drop|dropped|reject|rejected|block|blocked|deny|denied|accept|accepted|allow|allowed)\b`)
+)
+
+// Fill in the connection details fields from the summary of a netfilter log
+// message, for events where they were not set at ingestion
+func (e *Event) normalizeNetfilter() {
+	prefix, _, found := strings.Cut(e.Summary, "IN=")
+	if !found {
+		return
+	}
+	m := netfilterFieldRe.FindAllStringSubmatch(e.Summary, -1)
+	if m == nil {
+		return
+	}
+	d := &e.Details
+	for _, x := range m {
+		switch {
+		case x[1] == "SRC" && d.SourceIPAddress == "":
+			d.SourceIPAddress = x[2]
+		case x[1] == "DST" && d.DestinationIPAddress == "":
+			d.DestinationIPAddress = x[2]
+		case x[1] == "PROTO" && d.Proto == "":
+			d.Proto = strings.ToLower(x[2])
+		case x[1] == "SPT" && d.SourcePort == "":
+			d.SourcePort = Port(x[2])
+		case x[1] == "DPT" && d.DestinationPort == "":
+			d.DestinationPort = Port(x[2])
+		}
+	}
+	if a := netfilterActionRe.FindString(prefix); a != "" && d.Action == "" {
+		d.Action = netfilterAction(a)
+	}
+}
+
+// Return the action for a word found in a firewall log prefix, one of
+// accept or drop
+func netfilterAction(word string) string {
+	switch strings.ToLower(word) {
+	case "accept", "accepted", "allow", "allowed":
+		return "accept"
+	}
+	return "drop"
+}
+
+// Time returns the value of timestamp field field, either utctimestamp or
+// receivedtimestamp
+func (e *Event) Time(field string) time.Time {
+	if field == "receivedtimestamp" {
+		return e.ReceivedTimestamp
+	}
+	return e.UTCTimestamp
+}
+
+// Normalize fills in the common fields from the equivalent fields used by
+// the various event sources
+func (e *Event) Normalize() error {
+	if e.Hostname == "" && e.Details.DHost != "" {
+		e.Hostname = e.Details.DHost
+	}
+	if e.Details.User == "" && e.Details.DUser != "" {
+		e.Details.User = e.Details.DUser
+	}
+	if e.Details.User == "" && e.Details.Username != "" {
+		e.Details.User = e.Details.Username
+	}
+	if e.Details.Path == "" && e.Details.Fname != "" {
+		e.Details.Path = e.Details.Fname
+	}
+	if e.Details.OriginalUser == "" && e.Details.SUser != "" {
+		e.Details.OriginalUser = e.Details.SUser
+	}
+	if e.Details.ProcessName == "" && e.Details.DProc != "" {
+		e.Details.ProcessName = e.Details.DProc
+	}
+	if v, ok := AuditCategories[e.Details.Name]; ok {
+		e.Category = v
+	} else if v, ok := AuditCategories[e.Category]; ok {
+		e.Category = v
+	}
+
+	e.Summary = strings.Trim(e.Summary, " \n")
+	e.normalizeAVC()
+	e.normalizeNetfilter()
+	return nil
+}
+
+// Look up a dotted field path in a decoded document
+func lookupField(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, x := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[x]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// FieldValue returns the value of a dotted field path, preferring the
+// normalized event and falling back to the raw document for fields the
+// event does not model
+func (e *Event) FieldValue(path string) (string, error) {
+	for _, x := range []func() ([]byte, error){
+		func() ([]byte, error) { return json.Marshal(e) },
+		func() ([]byte, error) { return e.Raw, nil },
+	} {
+		buf, err := x()
+		if err != nil {
+			return "", err
+		}
+		if len(buf) == 0 {
+			continue
+		}
+		var doc map[string]interface{}
+		err = json.Unmarshal(buf, &doc)
+		if err != nil {
+			return "", err
+		}
+		v, ok := lookupField(doc, path)
+		if !ok || v == nil || v == "" {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		vbuf, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(vbuf), nil
+	}
+	return "", nil
+}
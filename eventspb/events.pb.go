@@ -0,0 +1,672 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: events.proto
+
+package eventspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SearchRequest selects the events to return, the fields correspond to the
+// flags of the search subcommands
+type SearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// audit, syslog or query, defaults to query
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// Time range, begin and end or last
+	Begin      string   `protobuf:"bytes,2,opt,name=begin,proto3" json:"begin,omitempty"`
+	End        string   `protobuf:"bytes,3,opt,name=end,proto3" json:"end,omitempty"`
+	Last       string   `protobuf:"bytes,4,opt,name=last,proto3" json:"last,omitempty"`
+	Hosts      []string `protobuf:"bytes,5,rep,name=hosts,proto3" json:"hosts,omitempty"`
+	Hostnocase bool     `protobuf:"varint,6,opt,name=hostnocase,proto3" json:"hostnocase,omitempty"`
+	Keyword    string   `protobuf:"bytes,7,opt,name=keyword,proto3" json:"keyword,omitempty"`
+	Tags       []string `protobuf:"bytes,8,rep,name=tags,proto3" json:"tags,omitempty"`
+	Groups     []string `protobuf:"bytes,9,rep,name=groups,proto3" json:"groups,omitempty"`
+	Severity   string   `protobuf:"bytes,10,opt,name=severity,proto3" json:"severity,omitempty"`
+	Origuser   string   `protobuf:"bytes,11,opt,name=origuser,proto3" json:"origuser,omitempty"`
+	Range      string   `protobuf:"bytes,12,opt,name=range,proto3" json:"range,omitempty"`
+	Filters    []string `protobuf:"bytes,13,rep,name=filters,proto3" json:"filters,omitempty"`
+	Sort       string   `protobuf:"bytes,14,opt,name=sort,proto3" json:"sort,omitempty"`
+	Limit      int64    `protobuf:"varint,15,opt,name=limit,proto3" json:"limit,omitempty"`
+	// Audit searches
+	Atype string `protobuf:"bytes,16,opt,name=atype,proto3" json:"atype,omitempty"`
+	Ses   string `protobuf:"bytes,17,opt,name=ses,proto3" json:"ses,omitempty"`
+	// Syslog searches
+	Program  string `protobuf:"bytes,18,opt,name=program,proto3" json:"program,omitempty"`
+	Facility string `protobuf:"bytes,19,opt,name=facility,proto3" json:"facility,omitempty"`
+	// Searches of any type
+	Doctype       string `protobuf:"bytes,20,opt,name=doctype,proto3" json:"doctype,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SearchRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetBegin() string {
+	if x != nil {
+		return x.Begin
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetLast() string {
+	if x != nil {
+		return x.Last
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetHosts() []string {
+	if x != nil {
+		return x.Hosts
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetHostnocase() bool {
+	if x != nil {
+		return x.Hostnocase
+	}
+	return false
+}
+
+func (x *SearchRequest) GetKeyword() string {
+	if x != nil {
+		return x.Keyword
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetGroups() []string {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetOriguser() string {
+	if x != nil {
+		return x.Origuser
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetRange() string {
+	if x != nil {
+		return x.Range
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *SearchRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetLimit() int64 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetAtype() string {
+	if x != nil {
+		return x.Atype
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetSes() string {
+	if x != nil {
+		return x.Ses
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetProgram() string {
+	if x != nil {
+		return x.Program
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetFacility() string {
+	if x != nil {
+		return x.Facility
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetDoctype() string {
+	if x != nil {
+		return x.Doctype
+	}
+	return ""
+}
+
+// EventDetails holds the details fields used by the normalized event
+type EventDetails struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Hostname        string                 `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Command         string                 `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Dhost           string                 `protobuf:"bytes,3,opt,name=dhost,proto3" json:"dhost,omitempty"`
+	Dproc           string                 `protobuf:"bytes,4,opt,name=dproc,proto3" json:"dproc,omitempty"`
+	Duser           string                 `protobuf:"bytes,5,opt,name=duser,proto3" json:"duser,omitempty"`
+	Suser           string                 `protobuf:"bytes,6,opt,name=suser,proto3" json:"suser,omitempty"`
+	Fname           string                 `protobuf:"bytes,7,opt,name=fname,proto3" json:"fname,omitempty"`
+	Name            string                 `protobuf:"bytes,8,opt,name=name,proto3" json:"name,omitempty"`
+	Processname     string                 `protobuf:"bytes,9,opt,name=processname,proto3" json:"processname,omitempty"`
+	Originaluser    string                 `protobuf:"bytes,10,opt,name=originaluser,proto3" json:"originaluser,omitempty"`
+	User            string                 `protobuf:"bytes,11,opt,name=user,proto3" json:"user,omitempty"`
+	Path            string                 `protobuf:"bytes,12,opt,name=path,proto3" json:"path,omitempty"`
+	Program         string                 `protobuf:"bytes,13,opt,name=program,proto3" json:"program,omitempty"`
+	Auditkey        string                 `protobuf:"bytes,14,opt,name=auditkey,proto3" json:"auditkey,omitempty"`
+	Ses             string                 `protobuf:"bytes,15,opt,name=ses,proto3" json:"ses,omitempty"`
+	AssetGroup      string                 `protobuf:"bytes,16,opt,name=asset_group,json=assetGroup,proto3" json:"asset_group,omitempty"`
+	Sourceipaddress string                 `protobuf:"bytes,17,opt,name=sourceipaddress,proto3" json:"sourceipaddress,omitempty"`
+	Sourcehostname  string                 `protobuf:"bytes,18,opt,name=sourcehostname,proto3" json:"sourcehostname,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *EventDetails) Reset() {
+	*x = EventDetails{}
+	mi := &file_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventDetails) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventDetails) ProtoMessage() {}
+
+func (x *EventDetails) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventDetails.ProtoReflect.Descriptor instead.
+func (*EventDetails) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EventDetails) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *EventDetails) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *EventDetails) GetDhost() string {
+	if x != nil {
+		return x.Dhost
+	}
+	return ""
+}
+
+func (x *EventDetails) GetDproc() string {
+	if x != nil {
+		return x.Dproc
+	}
+	return ""
+}
+
+func (x *EventDetails) GetDuser() string {
+	if x != nil {
+		return x.Duser
+	}
+	return ""
+}
+
+func (x *EventDetails) GetSuser() string {
+	if x != nil {
+		return x.Suser
+	}
+	return ""
+}
+
+func (x *EventDetails) GetFname() string {
+	if x != nil {
+		return x.Fname
+	}
+	return ""
+}
+
+func (x *EventDetails) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *EventDetails) GetProcessname() string {
+	if x != nil {
+		return x.Processname
+	}
+	return ""
+}
+
+func (x *EventDetails) GetOriginaluser() string {
+	if x != nil {
+		return x.Originaluser
+	}
+	return ""
+}
+
+func (x *EventDetails) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *EventDetails) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *EventDetails) GetProgram() string {
+	if x != nil {
+		return x.Program
+	}
+	return ""
+}
+
+func (x *EventDetails) GetAuditkey() string {
+	if x != nil {
+		return x.Auditkey
+	}
+	return ""
+}
+
+func (x *EventDetails) GetSes() string {
+	if x != nil {
+		return x.Ses
+	}
+	return ""
+}
+
+func (x *EventDetails) GetAssetGroup() string {
+	if x != nil {
+		return x.AssetGroup
+	}
+	return ""
+}
+
+func (x *EventDetails) GetSourceipaddress() string {
+	if x != nil {
+		return x.Sourceipaddress
+	}
+	return ""
+}
+
+func (x *EventDetails) GetSourcehostname() string {
+	if x != nil {
+		return x.Sourcehostname
+	}
+	return ""
+}
+
+// Event is a normalized MozDef event
+type Event struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Cluster           string                 `protobuf:"bytes,2,opt,name=cluster,proto3" json:"cluster,omitempty"`
+	Category          string                 `protobuf:"bytes,3,opt,name=category,proto3" json:"category,omitempty"`
+	Hostname          string                 `protobuf:"bytes,4,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Timestamp         *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Utctimestamp      *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=utctimestamp,proto3" json:"utctimestamp,omitempty"`
+	Receivedtimestamp *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=receivedtimestamp,proto3" json:"receivedtimestamp,omitempty"`
+	Summary           string                 `protobuf:"bytes,8,opt,name=summary,proto3" json:"summary,omitempty"`
+	Severity          string                 `protobuf:"bytes,9,opt,name=severity,proto3" json:"severity,omitempty"`
+	Tags              []string               `protobuf:"bytes,10,rep,name=tags,proto3" json:"tags,omitempty"`
+	Details           *EventDetails          `protobuf:"bytes,11,opt,name=details,proto3" json:"details,omitempty"`
+	// The document as stored in ES
+	Raw           []byte `protobuf:"bytes,12,opt,name=raw,proto3" json:"raw,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetCluster() string {
+	if x != nil {
+		return x.Cluster
+	}
+	return ""
+}
+
+func (x *Event) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *Event) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetUtctimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Utctimestamp
+	}
+	return nil
+}
+
+func (x *Event) GetReceivedtimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Receivedtimestamp
+	}
+	return nil
+}
+
+func (x *Event) GetSummary() string {
+	if x != nil {
+		return x.Summary
+	}
+	return ""
+}
+
+func (x *Event) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *Event) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Event) GetDetails() *EventDetails {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+func (x *Event) GetRaw() []byte {
+	if x != nil {
+		return x.Raw
+	}
+	return nil
+}
+
+var File_events_proto protoreflect.FileDescriptor
+
+const file_events_proto_rawDesc = "" +
+	"\n" +
+	"\fevents.proto\x12\x0fmozdefevents.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe5\x03\n" +
+	"\rSearchRequest\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
+	"\x05begin\x18\x02 \x01(\tR\x05begin\x12\x10\n" +
+	"\x03end\x18\x03 \x01(\tR\x03end\x12\x12\n" +
+	"\x04last\x18\x04 \x01(\tR\x04last\x12\x14\n" +
+	"\x05hosts\x18\x05 \x03(\tR\x05hosts\x12\x1e\n" +
+	"\n" +
+	"hostnocase\x18\x06 \x01(\bR\n" +
+	"hostnocase\x12\x18\n" +
+	"\akeyword\x18\a \x01(\tR\akeyword\x12\x12\n" +
+	"\x04tags\x18\b \x03(\tR\x04tags\x12\x16\n" +
+	"\x06groups\x18\t \x03(\tR\x06groups\x12\x1a\n" +
+	"\bseverity\x18\n" +
+	" \x01(\tR\bseverity\x12\x1a\n" +
+	"\boriguser\x18\v \x01(\tR\boriguser\x12\x14\n" +
+	"\x05range\x18\f \x01(\tR\x05range\x12\x18\n" +
+	"\afilters\x18\r \x03(\tR\afilters\x12\x12\n" +
+	"\x04sort\x18\x0e \x01(\tR\x04sort\x12\x14\n" +
+	"\x05limit\x18\x0f \x01(\x03R\x05limit\x12\x14\n" +
+	"\x05atype\x18\x10 \x01(\tR\x05atype\x12\x10\n" +
+	"\x03ses\x18\x11 \x01(\tR\x03ses\x12\x18\n" +
+	"\aprogram\x18\x12 \x01(\tR\aprogram\x12\x1a\n" +
+	"\bfacility\x18\x13 \x01(\tR\bfacility\x12\x18\n" +
+	"\adoctype\x18\x14 \x01(\tR\adoctype\"\xef\x03\n" +
+	"\fEventDetails\x12\x1a\n" +
+	"\bhostname\x18\x01 \x01(\tR\bhostname\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x14\n" +
+	"\x05dhost\x18\x03 \x01(\tR\x05dhost\x12\x14\n" +
+	"\x05dproc\x18\x04 \x01(\tR\x05dproc\x12\x14\n" +
+	"\x05duser\x18\x05 \x01(\tR\x05duser\x12\x14\n" +
+	"\x05suser\x18\x06 \x01(\tR\x05suser\x12\x14\n" +
+	"\x05fname\x18\a \x01(\tR\x05fname\x12\x12\n" +
+	"\x04name\x18\b \x01(\tR\x04name\x12 \n" +
+	"\vprocessname\x18\t \x01(\tR\vprocessname\x12\"\n" +
+	"\foriginaluser\x18\n" +
+	" \x01(\tR\foriginaluser\x12\x12\n" +
+	"\x04user\x18\v \x01(\tR\x04user\x12\x12\n" +
+	"\x04path\x18\f \x01(\tR\x04path\x12\x18\n" +
+	"\aprogram\x18\r \x01(\tR\aprogram\x12\x1a\n" +
+	"\bauditkey\x18\x0e \x01(\tR\bauditkey\x12\x10\n" +
+	"\x03ses\x18\x0f \x01(\tR\x03ses\x12\x1f\n" +
+	"\vasset_group\x18\x10 \x01(\tR\n" +
+	"assetGroup\x12(\n" +
+	"\x0fsourceipaddress\x18\x11 \x01(\tR\x0fsourceipaddress\x12&\n" +
+	"\x0esourcehostname\x18\x12 \x01(\tR\x0esourcehostname\"\xc2\x03\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\acluster\x18\x02 \x01(\tR\acluster\x12\x1a\n" +
+	"\bcategory\x18\x03 \x01(\tR\bcategory\x12\x1a\n" +
+	"\bhostname\x18\x04 \x01(\tR\bhostname\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12>\n" +
+	"\futctimestamp\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\futctimestamp\x12H\n" +
+	"\x11receivedtimestamp\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x11receivedtimestamp\x12\x18\n" +
+	"\asummary\x18\b \x01(\tR\asummary\x12\x1a\n" +
+	"\bseverity\x18\t \x01(\tR\bseverity\x12\x12\n" +
+	"\x04tags\x18\n" +
+	" \x03(\tR\x04tags\x127\n" +
+	"\adetails\x18\v \x01(\v2\x1d.mozdefevents.v1.EventDetailsR\adetails\x12\x10\n" +
+	"\x03raw\x18\f \x01(\fR\x03raw2R\n" +
+	"\fEventService\x12B\n" +
+	"\x06Search\x12\x1e.mozdefevents.v1.SearchRequest\x1a\x16.mozdefevents.v1.Event0\x01B-Z+github.com/ameihm0912/mozdefevents/eventspbb\x06proto3"
+
+var (
+	file_events_proto_rawDescOnce sync.Once
+	file_events_proto_rawDescData []byte
+)
+
+func file_events_proto_rawDescGZIP() []byte {
+	file_events_proto_rawDescOnce.Do(func() {
+		file_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_events_proto_rawDesc), len(file_events_proto_rawDesc)))
+	})
+	return file_events_proto_rawDescData
+}
+
+var file_events_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_events_proto_goTypes = []any{
+	(*SearchRequest)(nil),         // 0: mozdefevents.v1.SearchRequest
+	(*EventDetails)(nil),          // 1: mozdefevents.v1.EventDetails
+	(*Event)(nil),                 // 2: mozdefevents.v1.Event
+	(*timestamppb.Timestamp)(nil), // 3: google.protobuf.Timestamp
+}
+var file_events_proto_depIdxs = []int32{
+	3, // 0: mozdefevents.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	3, // 1: mozdefevents.v1.Event.utctimestamp:type_name -> google.protobuf.Timestamp
+	3, // 2: mozdefevents.v1.Event.receivedtimestamp:type_name -> google.protobuf.Timestamp
+	1, // 3: mozdefevents.v1.Event.details:type_name -> mozdefevents.v1.EventDetails
+	0, // 4: mozdefevents.v1.EventService.Search:input_type -> mozdefevents.v1.SearchRequest
+	2, // 5: mozdefevents.v1.EventService.Search:output_type -> mozdefevents.v1.Event
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_events_proto_init() }
+func file_events_proto_init() {
+	if File_events_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_events_proto_rawDesc), len(file_events_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_events_proto_goTypes,
+		DependencyIndexes: file_events_proto_depIdxs,
+		MessageInfos:      file_events_proto_msgTypes,
+	}.Build()
+	File_events_proto = out.File
+	file_events_proto_goTypes = nil
+	file_events_proto_depIdxs = nil
+}
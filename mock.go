@@ -0,0 +1,425 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MockBackend is an in-memory SearchBackend serving fixture documents, for
+// testing code that uses a Client without a cluster. The bool, match_all
+// and Criteria clauses are evaluated, including query_string clauses
+// of the form field: /regexp/. A query using anything else returns an error
+// rather than silently matching differently to a cluster.
+type MockBackend struct {
+	mu      sync.Mutex
+	indices map[string][]mockDoc
+}
+
+type mockDoc struct {
+	id     string
+	source json.RawMessage
+	doc    map[string]interface{}
+}
+
+// NewMockBackend returns an empty mock backend
+func NewMockBackend() *MockBackend {
+	return &MockBackend{indices: make(map[string][]mockDoc)}
+}
+
+// Add adds documents to index, creating the index if needed. Documents are
+// given sequential IDs within the index.
+func (m *MockBackend) Add(index string, docs ...json.RawMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, x := range docs {
+		var doc map[string]interface{}
+		err := json.Unmarshal(x, &doc)
+		if err != nil {
+			return err
+		}
+		id := strconv.Itoa(len(m.indices[index]) + 1)
+		m.indices[index] = append(m.indices[index], mockDoc{id: id, source: x, doc: doc})
+	}
+	if _, ok := m.indices[index]; !ok {
+		m.indices[index] = nil
+	}
+	return nil
+}
+
+// LoadNDJSON adds the documents in r to index, one JSON document per line
+func (m *MockBackend) LoadNDJSON(index string, r io.Reader) error {
+	docs := make([]json.RawMessage, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		docs = append(docs, json.RawMessage(line))
+	}
+	err := scanner.Err()
+	if err != nil {
+		return err
+	}
+	return m.Add(index, docs...)
+}
+
+// Return the documents in the comma separated list of indices matching the
+// query
+func (m *MockBackend) match(index string, q Query) ([]SearchHit, error) {
+	if q.PIT != nil || q.SearchAfter != nil {
+		return nil, errors.New("mock backend does not support point in time or search_after paging")
+	}
+	if len(q.Aggs) != 0 {
+		return nil, errors.New("mock backend does not support aggregations")
+	}
+	buf, err := json.Marshal(q.Query.Bool)
+	if err != nil {
+		return nil, err
+	}
+	var b mockBool
+	err = json.Unmarshal(buf, &b)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]SearchHit, 0)
+	for _, x := range strings.Split(index, ",") {
+		docs, ok := m.indices[x]
+		if !ok {
+			return nil, &esError{status: 404, body: fmt.Sprintf(`{"error":{"type":"index_not_found_exception","index":%q}}`, x)}
+		}
+		for _, d := range docs {
+			ok, err := b.match(d.doc)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			ret = append(ret, SearchHit{Index: x, ID: d.id, Source: d.source})
+		}
+	}
+	return ret, nil
+}
+
+// Search runs the query against the fixture documents in index
+func (m *MockBackend) Search(ctx context.Context, index string, doctype string, q Query) (SearchResult, error) {
+	var ret SearchResult
+	hits, err := m.match(index, q)
+	if err != nil {
+		return ret, err
+	}
+	for field, order := range q.Sort {
+		sort.SliceStable(hits, func(i, j int) bool {
+			a, _ := mockLookup(hits[i].Source, field)
+			b, _ := mockLookup(hits[j].Source, field)
+			if order == "desc" {
+				return mockCompare(a, b) > 0
+			}
+			return mockCompare(a, b) < 0
+		})
+	}
+	ret.Hits.Total = HitsTotal(len(hits))
+	if q.From < len(hits) {
+		hits = hits[q.From:]
+	} else {
+		hits = nil
+	}
+	if len(hits) > q.Size {
+		hits = hits[:q.Size]
+	}
+	ret.Hits.Hits = hits
+	ret.RawJSON, err = json.Marshal(ret)
+	return ret, err
+}
+
+// Count returns the number of fixture documents in index matching the query
+func (m *MockBackend) Count(ctx context.Context, index string, doctype string, q Query) (int, error) {
+	hits, err := m.match(index, q)
+	if err != nil {
+		return 0, err
+	}
+	return len(hits), nil
+}
+
+func mockLookup(source json.RawMessage, field string) (string, bool) {
+	var doc map[string]interface{}
+	if json.Unmarshal(source, &doc) != nil {
+		return "", false
+	}
+	return mockField(doc, field)
+}
+
+// Return the value of field in doc as a string. The document type is
+// matched against the type field of the document, as in clusters without
+// document types.
+func mockField(doc map[string]interface{}, field string) (string, bool) {
+	if field == "_type" {
+		field = "type"
+	}
+	field = strings.TrimSuffix(field, ".keyword")
+	v, ok := lookupField(doc, field)
+	if !ok || v == nil {
+		return "", false
+	}
+	if s, ok := v.(string); ok {
+		return s, true
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(buf), true
+}
+
+// mockBool is a bool clause, the clauses are kept as JSON as filter and
+// must_not clauses can be any query
+type mockBool struct {
+	Must           []json.RawMessage `json:"must"`
+	Should         []json.RawMessage `json:"should"`
+	Filter         []json.RawMessage `json:"filter"`
+	MustNot        []json.RawMessage `json:"must_not"`
+	MinShouldMatch interface{}       `json:"minimum_should_match"`
+}
+
+func (b mockBool) match(doc map[string]interface{}) (bool, error) {
+	for _, x := range [][]json.RawMessage{b.Must, b.Filter} {
+		n, err := mockMatchCount(doc, x)
+		if err != nil || n != len(x) {
+			return false, err
+		}
+	}
+	n, err := mockMatchCount(doc, b.MustNot)
+	if err != nil || n != 0 {
+		return false, err
+	}
+	if len(b.Should) == 0 {
+		return true, nil
+	}
+	// Without must or filter clauses at least one should clause has to
+	// match
+	min := 0
+	if len(b.Must) == 0 && len(b.Filter) == 0 {
+		min = 1
+	}
+	switch v := b.MinShouldMatch.(type) {
+	case nil:
+	case float64:
+		min = int(v)
+	case string:
+		min, err = strconv.Atoi(v)
+		if err != nil {
+			return false, fmt.Errorf("mock backend does not support minimum_should_match %q", v)
+		}
+	default:
+		return false, fmt.Errorf("mock backend does not support minimum_should_match %v", v)
+	}
+	n, err = mockMatchCount(doc, b.Should)
+	return n >= min, err
+}
+
+func mockMatchCount(doc map[string]interface{}, clauses []json.RawMessage) (int, error) {
+	ret := 0
+	for _, x := range clauses {
+		ok, err := mockMatchClause(doc, x)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			ret++
+		}
+	}
+	return ret, nil
+}
+
+// Evaluate a single query clause against doc
+func mockMatchClause(doc map[string]interface{}, clause json.RawMessage) (bool, error) {
+	var keys map[string]json.RawMessage
+	err := json.Unmarshal(clause, &keys)
+	if err != nil {
+		return false, err
+	}
+	if v, ok := keys["bool"]; ok && len(keys) == 1 {
+		var b mockBool
+		err = json.Unmarshal(v, &b)
+		if err != nil {
+			return false, err
+		}
+		return b.match(doc)
+	}
+	if _, ok := keys["match_all"]; ok && len(keys) == 1 {
+		return true, nil
+	}
+	var qc Criteria
+	d := json.NewDecoder(bytes.NewReader(clause))
+	d.DisallowUnknownFields()
+	if d.Decode(&qc) != nil {
+		return false, fmt.Errorf("mock backend does not support clause %s", clause)
+	}
+	return mockMatch(doc, qc)
+}
+
+// Evaluate a single criteria against doc, all the clauses set in the
+// criteria must match
+func mockMatch(doc map[string]interface{}, qc Criteria) (bool, error) {
+	if len(qc.QueryString) != 0 {
+		ok, err := mockQueryString(doc, qc.QueryString)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if qc.Nested != nil {
+		// Fields under the nested path are addressed by their full path
+		// so the inner query can be evaluated against the document
+		if qc.Nested.Query == nil {
+			return false, nil
+		}
+		return mockMatch(doc, *qc.Nested.Query)
+	}
+	if v, ok := qc.Exists["field"]; ok {
+		if _, ok := mockField(doc, v); !ok {
+			return false, nil
+		}
+	}
+	for k, v := range qc.Term {
+		s, ok := mockField(doc, k)
+		if !ok || s != v {
+			return false, nil
+		}
+	}
+	for k, v := range qc.Terms {
+		s, ok := mockField(doc, k)
+		if !ok {
+			return false, nil
+		}
+		found := false
+		for _, x := range v {
+			if s == x {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	for k, v := range qc.Match {
+		s, ok := mockField(doc, k)
+		if !ok || !mockTokensMatch(s, v) {
+			return false, nil
+		}
+	}
+	for k, v := range qc.Range {
+		s, ok := mockField(doc, k)
+		if !ok {
+			return false, nil
+		}
+		for op, bound := range v {
+			c := mockCompare(s, bound)
+			var ok bool
+			switch op {
+			case "gte":
+				ok = c >= 0
+			case "gt":
+				ok = c > 0
+			case "lte":
+				ok = c <= 0
+			case "lt":
+				ok = c < 0
+			default:
+				return false, fmt.Errorf("mock backend does not support range operator %v", op)
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// Evaluate a query_string clause of the form field: /regexp/. As against a
+// keyword field the regexp has to match the whole value. Lucene regular
+// expressions are evaluated as Go regular expressions, the two agree on the
+// syntax used by the queries built by this package.
+func mockQueryString(doc map[string]interface{}, qs map[string]string) (bool, error) {
+	query, ok := qs["query"]
+	if !ok || len(qs) != 1 {
+		return false, errors.New("mock backend only supports the query parameter of query_string clauses")
+	}
+	field, value, _ := strings.Cut(query, ":")
+	field = strings.TrimSpace(field)
+	value = strings.TrimSpace(value)
+	if field == "" || len(value) < 2 || value[0] != '/' || value[len(value)-1] != '/' {
+		return false, fmt.Errorf("mock backend only supports field: /regexp/ query_string clauses, got %q", query)
+	}
+	re, err := regexp.Compile("^(?:" + value[1:len(value)-1] + ")$")
+	if err != nil {
+		return false, fmt.Errorf("query_string %q: %v", query, err)
+	}
+	s, ok := mockField(doc, field)
+	return ok && re.MatchString(s), nil
+}
+
+// Return true if any token of the query appears in the value, similar to
+// a match query against an analyzed field
+func mockTokensMatch(value string, query string) bool {
+	split := func(s string) []string {
+		return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+	}
+	tokens := make(map[string]bool)
+	for _, x := range split(value) {
+		tokens[x] = true
+	}
+	for _, x := range split(query) {
+		if tokens[x] {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare two field values as timestamps or numbers if both parse as one,
+// and as strings otherwise
+func mockCompare(a string, b string) int {
+	if ta, err := time.Parse(time.RFC3339Nano, a); err == nil {
+		if tb, err := time.Parse(time.RFC3339Nano, b); err == nil {
+			return ta.Compare(tb)
+		}
+	}
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
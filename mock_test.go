@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newMockClient(t *testing.T) *Client {
+	t.Helper()
+	m := NewMockBackend()
+	err := m.LoadNDJSON("events-20240305", strings.NewReader(`
+{"type":"event","utctimestamp":"2024-03-05T01:00:00Z","hostname":"web1.prod.example.com","category":"syslog","summary":"Accepted publickey for alice","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T02:00:00Z","hostname":"WEB2.prod.example.com","category":"syslog","summary":"Failed password for bob","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T03:00:00Z","hostname":"ci7.example.com","category":"syslog","summary":"Failed password for root","details":{"program":"sshd"}}
+{"type":"event","utctimestamp":"2024-03-05T04:00:00Z","category":"dns","details":{"hostname":"ns1.example.com","query":"www.Evil.example."}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(nil, WithBackend(m), WithVersion(Version{Major: 7}), WithoutReconcile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func mockQuery(t *testing.T, must []Criteria, should []Criteria, filter []string, mustNot []string) Query {
+	t.Helper()
+	q := Query{Size: 10, Sort: map[string]string{"utctimestamp": "asc"}}
+	q.Query.Bool.Must = must
+	q.Query.Bool.Should = should
+	for _, x := range filter {
+		q.Query.Bool.Filter = append(q.Query.Bool.Filter, json.RawMessage(x))
+	}
+	for _, x := range mustNot {
+		q.Query.Bool.MustNot = append(q.Query.Bool.MustNot, json.RawMessage(x))
+	}
+	return q
+}
+
+func hostRegexp(field string, re string) Criteria {
+	return Criteria{QueryString: map[string]string{"query": field + ": /" + re + "/"}}
+}
+
+func TestMockBackendClauses(t *testing.T) {
+	c := newMockClient(t)
+	summaries, err := ShouldClause([]Criteria{
+		{Match: map[string]string{"summary": "Accepted"}},
+		{Match: map[string]string{"summary": "Failed"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{
+			"filter",
+			mockQuery(t, nil, nil, []string{string(summaries)}, nil),
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com", "ci7.example.com"},
+		},
+		{
+			"must_not",
+			mockQuery(t, nil, nil, []string{string(summaries)},
+				[]string{`{"query_string":{"query":"hostname: /ci[0-9]+\\.example\\.com/"}}`}),
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com"},
+		},
+		{
+			"query_string whole value",
+			mockQuery(t, []Criteria{hostRegexp("hostname", `web[0-9]+`)}, nil, nil, nil),
+			[]string{},
+		},
+		{
+			"query_string case sensitive",
+			mockQuery(t, []Criteria{hostRegexp("hostname", `web[0-9]+\.prod\..*`)}, nil, nil, nil),
+			[]string{"web1.prod.example.com"},
+		},
+		{
+			"query_string case insensitive",
+			mockQuery(t, []Criteria{hostRegexp("hostname.keyword", CaseInsensitiveRegexp(`web[0-9]+\.prod\..*`))}, nil, nil, nil),
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com"},
+		},
+		{
+			"should with filter is optional",
+			mockQuery(t, nil, []Criteria{hostRegexp("hostname", `nomatch`)}, []string{string(summaries)}, nil),
+			[]string{"web1.prod.example.com", "WEB2.prod.example.com", "ci7.example.com"},
+		},
+		{
+			"nested bool and exists",
+			mockQuery(t, nil, nil, []string{`{"bool":{"must":[{"exists":{"field":"details.query"}}],` +
+				`"must_not":[{"match":{"category":"syslog"}}]}}`}, nil),
+			[]string{"ns1.example.com"},
+		},
+	}
+	for _, x := range tests {
+		got := make([]string, 0)
+		for e, err := range c.Events(context.Background(), []string{"events-20240305"}, "", x.q) {
+			if err != nil {
+				t.Fatalf("%v: %v", x.name, err)
+			}
+			host := e.Hostname
+			if host == "" {
+				host = e.Details.Hostname
+			}
+			got = append(got, host)
+		}
+		if strings.Join(got, ",") != strings.Join(x.want, ",") {
+			t.Errorf("%v: got %v, want %v", x.name, got, x.want)
+		}
+		n, err := c.Count(context.Background(), "events-20240305", "", x.q)
+		if err != nil || n != len(x.want) {
+			t.Errorf("%v: count got %v %v, want %v", x.name, n, err, len(x.want))
+		}
+	}
+}
+
+func TestMockBackendUnsupported(t *testing.T) {
+	c := newMockClient(t)
+	for _, x := range []Query{
+		mockQuery(t, nil, nil, []string{`{"prefix":{"hostname":"web"}}`}, nil),
+		mockQuery(t, nil, nil, nil, []string{`{"match":{"summary":{"query":"Failed"}}}`}),
+		mockQuery(t, []Criteria{{QueryString: map[string]string{"query": "hostname:web*"}}}, nil, nil, nil),
+	} {
+		err := c.Search(context.Background(), "events-20240305", "", x, func([]Event) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf("expected error for %+v", x.Query.Bool)
+		}
+	}
+}
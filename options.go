@@ -0,0 +1,193 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Client
+type Option func(*Client) error
+
+// WithBasicAuth authenticates to the cluster with a user and password
+func WithBasicAuth(user string, password string) Option {
+	return func(c *Client) error {
+		if c.esConfig.APIKey != "" {
+			return errors.New("basic authentication cannot be used with an API key")
+		}
+		c.esConfig.Username = user
+		c.esConfig.Password = password
+		return nil
+	}
+}
+
+// WithAPIKey authenticates to the cluster with an encoded API key
+func WithAPIKey(key string) Option {
+	return func(c *Client) error {
+		if c.esConfig.Username != "" {
+			return errors.New("an API key cannot be used with basic authentication")
+		}
+		c.esConfig.APIKey = key
+		return nil
+	}
+}
+
+// WithTransport sets the transport used for requests, for example to
+// configure TLS or sign requests
+func WithTransport(t http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.esConfig.Transport = t
+		return nil
+	}
+}
+
+// WithGzip compresses request bodies. Only request bodies are affected,
+// responses are compressed if the transport asks for it, which the default
+// transport does unless its DisableCompression is set.
+func WithGzip() Option {
+	return func(c *Client) error {
+		c.esConfig.CompressRequestBody = true
+		return nil
+	}
+}
+
+// WithOpenSearch connects to an OpenSearch cluster rather than
+// Elasticsearch
+func WithOpenSearch() Option {
+	return func(c *Client) error {
+		c.Version.OpenSearch = true
+		return nil
+	}
+}
+
+// WithVersion sets the cluster version instead of detecting it. The cluster
+// is OpenSearch if either v or WithOpenSearch says so, whatever the order
+// of the options.
+func WithVersion(v Version) Option {
+	return func(c *Client) error {
+		opensearch := c.Version.OpenSearch
+		c.Version = v
+		c.Version.OpenSearch = v.OpenSearch || opensearch
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for each request, 0 for none
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		if d < 0 {
+			return errors.New("timeout must not be negative")
+		}
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithBudget limits the number of requests the client will make, 0 for
+// unlimited
+func WithBudget(n int) Option {
+	return func(c *Client) error {
+		if n < 0 {
+			return errors.New("request budget must not be negative")
+		}
+		c.budget = n
+		return nil
+	}
+}
+
+// WithPaging sets how searches page through results, the default is
+// PagingFrom
+func WithPaging(p Paging) Option {
+	return func(c *Client) error {
+		if p == PagingScroll && c.pit {
+			return errors.New("point in time searches cannot use scroll paging")
+		}
+		c.paging = p
+		return nil
+	}
+}
+
+// WithPIT runs each search against a point in time, giving a consistent
+// snapshot of the index for the search
+func WithPIT() Option {
+	return func(c *Client) error {
+		if c.paging == PagingScroll {
+			return errors.New("point in time searches cannot use scroll paging")
+		}
+		c.pit = true
+		return nil
+	}
+}
+
+// WithPageDelay waits for d between fetching pages of a search, reducing
+// the load on the cluster
+func WithPageDelay(d time.Duration) Option {
+	return func(c *Client) error {
+		c.pageDelay = d
+		return nil
+	}
+}
+
+// WithoutReconcile disables comparing the number of documents fetched by a
+// search against the count API, for example when the index is expected to
+// be changing
+func WithoutReconcile() Option {
+	return func(c *Client) error {
+		c.reconcile = false
+		return nil
+	}
+}
+
+// WithWarnf sets the function called to report problems that do not stop a
+// search, warnings are discarded by default
+func WithWarnf(f func(format string, args ...interface{})) Option {
+	return func(c *Client) error {
+		c.warn = f
+		return nil
+	}
+}
+
+// WithLogger logs the progress of searches to l, the indices searched,
+// pages fetched and hit counts at info level and individual requests,
+// queries and retries at debug level. Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Client) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// WithOnPage sets a function called after each page of a search is fetched
+func WithOnPage(f func(index string, latency time.Duration, documents int, bytes int)) Option {
+	return func(c *Client) error {
+		c.onPage = f
+		return nil
+	}
+}
+
+// WithBackend runs searches with b rather than the official client, for
+// example a MockBackend. The cluster version cannot be detected through a
+// backend that only runs searches, so it should be set with WithVersion.
+func WithBackend(b SearchBackend) Option {
+	return func(c *Client) error {
+		c.backend = b
+		return nil
+	}
+}
+
+// WithEnrichers runs the enrichers on each event returned by a search, in
+// the order given, before the events are passed to the search handler
+func WithEnrichers(e ...Enricher) Option {
+	return func(c *Client) error {
+		c.enrichers = append(c.enrichers, e...)
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"testing"
+)
+
+func TestWithVersionKeepsOpenSearch(t *testing.T) {
+	v := Version{Major: 2}
+	for _, opts := range [][]Option{
+		{WithOpenSearch(), WithVersion(v)},
+		{WithVersion(v), WithOpenSearch()},
+	} {
+		c, err := NewClient(nil, append(opts, WithBackend(NewMockBackend()))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.Version.OpenSearch || c.Version.Major != 2 {
+			t.Errorf("got version %+v, want OpenSearch 2", c.Version)
+		}
+	}
+}
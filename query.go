@@ -0,0 +1,272 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Contributor:
+// - Aaron Meihm ameihm@mozilla.com
+
+package mozdefevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Criteria is a single query clause
+type Criteria struct {
+	QueryString map[string]string            `json:"query_string,omitempty"`
+	Term        map[string]string            `json:"term,omitempty"`
+	Terms       map[string][]string          `json:"terms,omitempty"`
+	Match       map[string]string            `json:"match,omitempty"`
+	Range       map[string]map[string]string `json:"range,omitempty"`
+	Exists      map[string]string            `json:"exists,omitempty"`
+	Nested      *NestedQuery                 `json:"nested,omitempty"`
+}
+
+// NestedQuery wraps criteria on fields of a nested object
+type NestedQuery struct {
+	Path  string    `json:"path"`
+	Query *Criteria `json:"query"`
+}
+
+// PointInTime identifies a point in time the search is run against
+type PointInTime struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive"`
+}
+
+// Query is a search body
+type Query struct {
+	From  int                    `json:"from"`
+	Size  int                    `json:"size"`
+	Sort  map[string]string      `json:"sort"`
+	PIT   *PointInTime           `json:"pit,omitempty"`
+	Aggs  map[string]Aggregation `json:"aggs,omitempty"`
+	Query struct {
+		Bool struct {
+			Must           []Criteria        `json:"must,omitempty"`
+			Should         []Criteria        `json:"should,omitempty"`
+			Filter         []json.RawMessage `json:"filter,omitempty"`
+			MustNot        []json.RawMessage `json:"must_not,omitempty"`
+			MinShouldMatch int               `json:"minimum_should_match,omitempty"`
+		} `json:"bool"`
+	} `json:"query"`
+
+	// Sort values of the last hit of the previous page when paging with
+	// search_after
+	SearchAfter []interface{} `json:"search_after,omitempty"`
+
+	// Fields returned in the document source, all fields if empty
+	Source []string `json:"_source,omitempty"`
+}
+
+type DateHistogramAgg struct {
+	Field         string `json:"field"`
+	Interval      string `json:"interval,omitempty"`
+	FixedInterval string `json:"fixed_interval,omitempty"`
+}
+
+type TermsAgg struct {
+	Field string `json:"field"`
+	Size  int    `json:"size"`
+}
+
+type CardinalityAgg struct {
+	Field string `json:"field"`
+}
+
+// Aggregation is a single named aggregation in a query
+type Aggregation struct {
+	DateHistogram *DateHistogramAgg `json:"date_histogram,omitempty"`
+	Terms         *TermsAgg         `json:"terms,omitempty"`
+	Cardinality   *CardinalityAgg   `json:"cardinality,omitempty"`
+
+	// Sub-aggregations computed for each bucket
+	Aggs map[string]Aggregation `json:"aggs,omitempty"`
+}
+
+// AggBucket is a single bucket of a bucket aggregation. The key is the
+// number or string the bucket is for, and Aggs holds the results of any
+// sub-aggregations.
+type AggBucket struct {
+	Key      json.Number          `json:"key"`
+	DocCount int                  `json:"doc_count"`
+	Aggs     map[string]AggResult `json:"-"`
+}
+
+// UnmarshalJSON decodes a bucket, accepting the string keys of terms
+// aggregations on keyword fields and collecting the sub-aggregation results
+// which are keyed by their names
+func (b *AggBucket) UnmarshalJSON(buf []byte) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(buf, &fields)
+	if err != nil {
+		return err
+	}
+	*b = AggBucket{}
+	for k, v := range fields {
+		switch k {
+		case "key":
+			var key interface{}
+			d := json.NewDecoder(strings.NewReader(string(v)))
+			d.UseNumber()
+			err = d.Decode(&key)
+			if err != nil {
+				return err
+			}
+			b.Key = json.Number(fmt.Sprint(key))
+		case "doc_count":
+			err = json.Unmarshal(v, &b.DocCount)
+			if err != nil {
+				return err
+			}
+		default:
+			if len(v) == 0 || v[0] != '{' {
+				continue
+			}
+			var res AggResult
+			if json.Unmarshal(v, &res) != nil {
+				continue
+			}
+			if b.Aggs == nil {
+				b.Aggs = make(map[string]AggResult)
+			}
+			b.Aggs[k] = res
+		}
+	}
+	return nil
+}
+
+// AggResult is the result of an aggregation, the fields set depend on the
+// type of aggregation
+type AggResult struct {
+	Buckets  []AggBucket `json:"buckets"`
+	SumOther int         `json:"sum_other_doc_count"`
+	Value    int         `json:"value"`
+}
+
+// AddMatch requires the query to match val against field key
+func (q *Query) AddMatch(key string, val string) {
+	var qc Criteria
+	qc.Match = make(map[string]string)
+	qc.Match[key] = val
+	q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+}
+
+// AddExists requires the query to match documents with a value for field
+func (q *Query) AddExists(field string) {
+	var qc Criteria
+	qc.Exists = map[string]string{"field": field}
+	q.Query.Bool.Must = append(q.Query.Bool.Must, qc)
+}
+
+// AddTypeMatch requires documents of type doctype, ES 7 and later no
+// longer have document types so the type field of the document is matched
+// instead
+func (q *Query) AddTypeMatch(doctype string, v Version) {
+	if v.Typeless() {
+		q.AddMatch("type", doctype)
+		return
+	}
+	q.AddMatch("_type", doctype)
+}
+
+// ApplyNested wraps the must and should criteria that apply to fields under
+// path in nested queries
+func (q *Query) ApplyNested(path string) {
+	for i := range q.Query.Bool.Must {
+		q.Query.Bool.Must[i] = NestCriteria(q.Query.Bool.Must[i], path)
+	}
+	for i := range q.Query.Bool.Should {
+		q.Query.Bool.Should[i] = NestCriteria(q.Query.Bool.Should[i], path)
+	}
+}
+
+// Fields returns the fields a criteria applies to
+func (qc Criteria) Fields() []string {
+	ret := make([]string, 0)
+	for k := range qc.Term {
+		ret = append(ret, k)
+	}
+	for k := range qc.Terms {
+		ret = append(ret, k)
+	}
+	for k := range qc.Match {
+		ret = append(ret, k)
+	}
+	for k := range qc.Range {
+		ret = append(ret, k)
+	}
+	if v, ok := qc.Exists["field"]; ok {
+		ret = append(ret, v)
+	}
+	if v, ok := qc.QueryString["query"]; ok {
+		if field, _, found := strings.Cut(v, ":"); found {
+			ret = append(ret, strings.TrimSpace(field))
+		}
+	}
+	return ret
+}
+
+// NestCriteria wraps the criteria in a nested query if it applies to fields
+// under path, so it matches documents where that object is mapped as
+// nested. The criteria is returned unchanged if path is empty.
+func NestCriteria(qc Criteria, path string) Criteria {
+	if path == "" || qc.Nested != nil {
+		return qc
+	}
+	fields := qc.Fields()
+	if len(fields) == 0 {
+		return qc
+	}
+	for _, x := range fields {
+		if !strings.HasPrefix(x, path+".") {
+			return qc
+		}
+	}
+	return Criteria{Nested: &NestedQuery{Path: path, Query: &qc}}
+}
+
+// ShouldClause builds a bool clause requiring at least one of criteria to
+// match, for use as a filter where the top level should clauses are already
+// in use
+func ShouldClause(criteria []Criteria) (json.RawMessage, error) {
+	var clause struct {
+		Bool struct {
+			Should         []Criteria `json:"should"`
+			MinShouldMatch int        `json:"minimum_should_match"`
+		} `json:"bool"`
+	}
+	clause.Bool.Should = append(clause.Bool.Should, criteria...)
+	clause.Bool.MinShouldMatch = 1
+	return json.Marshal(clause)
+}
+
+// CaseInsensitiveRegexp returns a case insensitive version of a Lucene
+// regular expression. Lucene regular expressions have no case insensitive
+// flag, so each letter outside of a character class is expanded into a
+// class matching either case.
+func CaseInsensitiveRegexp(s string) string {
+	var ret strings.Builder
+	inclass := false
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '[':
+			inclass = true
+		case c == ']':
+			inclass = false
+		case !inclass && unicode.IsLetter(c) && unicode.ToLower(c) != unicode.ToUpper(c):
+			ret.WriteString("[" + string(unicode.ToLower(c)) + string(unicode.ToUpper(c)) + "]")
+			continue
+		}
+		ret.WriteRune(c)
+	}
+	return ret.String()
+}